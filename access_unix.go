@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// writable returns true if the current user can create files in dir
+func writable(dir string) bool {
+	return unix.Access(dir, unix.W_OK) == nil
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+)
+
+// writable returns true if dir isn't read-only, which is all that the
+// permission bits tell on Windows
+func writable(dir string) bool {
+	fi, err := os.Stat(dir)
+	return err == nil && fi.Mode().Perm()&0200 != 0
+}
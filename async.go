@@ -0,0 +1,302 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/direnv/direnv/v2/gzenv"
+)
+
+// asyncJobTTL is how long the files of a job that nobody came back for are
+// kept around.
+const asyncJobTTL = 24 * time.Hour
+
+// asyncJob is a load of an .envrc running in the background. It's tracked
+// with a few files in the jobs dir, all named after the job key:
+//
+//   KEY.running contains the PID of the process doing the load, and is empty
+//               while the process is being started
+//   KEY.log     contains the stderr of the load
+//   KEY.done    contains the marshalled asyncResult once the load is over
+type asyncJob struct {
+	dir string
+	key string
+}
+
+// asyncResult is what a background load hands over to the next prompt
+type asyncResult struct {
+	// Diff holds the changes made by the .envrc, without DIRENV_DIFF which
+	// is computed when the result is applied.
+	Diff  *EnvDiff `json:"diff"`
+	Error string   `json:"error"`
+	// EvalError is set when the .envrc itself failed
+	EvalError string `json:"eval_error"`
+}
+
+// newAsyncJob returns the job that loads rcPath on top of previousEnv. The
+// key changes with the content of the .envrc and with the environment, so
+// that an outdated result is never applied.
+func newAsyncJob(config *Config, rcPath string, previousEnv Env) (*asyncJob, error) {
+	hash, err := fileHash(rcPath)
+	if err != nil {
+		return nil, err
+	}
+	// The hash covers the path and the content of the .envrc. The direnv
+	// variables are ignored as they differ depending on whether the previous
+	// .envrc has already been unloaded, and so are the ones that change
+	// freely, like PWD when moving to a subdirectory during the load.
+	env := previousEnv.Copy()
+	env.CleanContext()
+	for key := range env {
+		if IgnoredEnv(key) {
+			delete(env, key)
+		}
+	}
+	key := sha256.Sum256([]byte(hash + "\n" + env.Serialize()))
+	return &asyncJob{config.JobsDir(), fmt.Sprintf("%x", key[:16])}, nil
+}
+
+func (job *asyncJob) path(ext string) string {
+	return filepath.Join(job.dir, job.key+ext)
+}
+
+// asyncClaimTimeout is how long a job can stay claimed without a PID before
+// the claim is considered abandoned, for example because direnv was killed
+// while starting the load.
+const asyncClaimTimeout = 10 * time.Second
+
+// Running returns true if the job is claimed by a live process, or is about
+// to be.
+func (job *asyncJob) Running() bool {
+	info, stale, err := job.readClaim()
+	return info != nil && err == nil && !stale
+}
+
+// readClaim returns the .running file of the job, and whether it was
+// abandoned: its process is gone, or it never got a PID, or it's too old for
+// the PID to be trusted. info is nil if the job isn't claimed.
+func (job *asyncJob) readClaim() (info os.FileInfo, stale bool, err error) {
+	file, err := os.Open(job.path(".running"))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return
+	}
+	defer file.Close()
+
+	if info, err = file.Stat(); err != nil {
+		return
+	}
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return
+	}
+
+	age := time.Since(info.ModTime())
+	if age > asyncJobTTL {
+		return info, true, nil
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return info, age > asyncClaimTimeout, nil
+	}
+	return info, !processAlive(pid), nil
+}
+
+// claim marks the job as taken so that a concurrent prompt doesn't start it
+// as well. ok is false if the job is already claimed by someone else.
+func (job *asyncJob) claim() (ok bool, err error) {
+	for {
+		file, err := os.OpenFile(job.path(".running"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			return true, file.Close()
+		} else if !os.IsExist(err) {
+			return false, err
+		}
+
+		if ok, err = job.takeOver(); !ok || err != nil {
+			return false, err
+		}
+	}
+}
+
+// takeOver removes an abandoned claim. Before it's removed, the claim is
+// moved out of the way and compared with the one that was read, so that a
+// concurrent prompt that has just taken over the job keeps it.
+func (job *asyncJob) takeOver() (ok bool, err error) {
+	info, stale, err := job.readClaim()
+	if err != nil || !stale {
+		return false, err
+	}
+	if info == nil {
+		// Released in the meantime
+		return true, nil
+	}
+
+	moved := job.path(fmt.Sprintf(".running.%d.tmp", os.Getpid()))
+	if err = os.Rename(job.path(".running"), moved); os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer os.Remove(moved)
+
+	if movedInfo, err := os.Stat(moved); err == nil && !os.SameFile(info, movedInfo) {
+		// This is a new claim, put it back
+		return false, os.Link(moved, job.path(".running"))
+	}
+	return true, nil
+}
+
+// Start spawns `direnv async-load` to load rcPath in the background. Nothing
+// is done if a concurrent prompt has already started the job.
+func (job *asyncJob) Start(currentEnv Env, rcPath string, config *Config) (err error) {
+	if err = os.MkdirAll(job.dir, 0755); err != nil {
+		return
+	}
+	job.pruneOld()
+
+	ok, err := job.claim()
+	if !ok || err != nil {
+		return
+	}
+
+	logFile, err := os.Create(job.path(".log"))
+	if err != nil {
+		_ = os.Remove(job.path(".running"))
+		return
+	}
+	defer logFile.Close()
+
+	// G204: Subprocess launched with function call as argument or cmd arguments
+	// #nosec
+	cmd := exec.Command(config.SelfPath, "async-load", job.key, rcPath)
+	cmd.Dir = config.WorkDir
+	cmd.Env = currentEnv.ToGoEnv()
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detachProcess(cmd)
+
+	if err = cmd.Start(); err != nil {
+		_ = os.Remove(job.path(".running"))
+		return
+	}
+
+	// The claim is replaced at once so that it's never read without its PID
+	if err = job.writeFile(".running", strconv.Itoa(cmd.Process.Pid)+"\n"); err != nil {
+		return
+	}
+
+	return cmd.Process.Release()
+}
+
+// Finish records the result of the load and marks the job as done
+func (job *asyncJob) Finish(result *asyncResult) (err error) {
+	defer os.Remove(job.path(".running"))
+
+	return job.writeFile(".done", gzenv.Marshal(result))
+}
+
+// writeFile replaces the job file with the given extension. The content is
+// written to a temporary file first so that it's never read partially.
+func (job *asyncJob) writeFile(ext, content string) (err error) {
+	tmp, err := ioutil.TempFile(job.dir, job.key+".*.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+
+	return os.Rename(tmp.Name(), job.path(ext))
+}
+
+// Result returns the result of a finished job, along with the stderr of the
+// load, and removes the job files. It returns nil if the job isn't done.
+func (job *asyncJob) Result(stderr io.Writer) (*asyncResult, error) {
+	data, err := ioutil.ReadFile(job.path(".done"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if logFile, err := os.Open(job.path(".log")); err == nil {
+		_, _ = io.Copy(stderr, logFile)
+		logFile.Close()
+	}
+
+	for _, ext := range []string{".done", ".log", ".running"} {
+		_ = os.Remove(job.path(ext))
+	}
+
+	result := new(asyncResult)
+	if err = gzenv.Unmarshal(string(data), result); err != nil {
+		return nil, err
+	}
+	if result.Diff == nil {
+		return nil, errors.New("background load didn't produce a diff")
+	}
+	return result, nil
+}
+
+// pruneOld removes the files of the jobs that were never picked up, for
+// example because the user left the directory before the load finished.
+func (job *asyncJob) pruneOld() {
+	entries, err := ioutil.ReadDir(job.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if time.Since(entry.ModTime()) > asyncJobTTL {
+			_ = os.Remove(filepath.Join(job.dir, entry.Name()))
+		}
+	}
+}
+
+// exportAsync loads the .envrc in the background. It returns the new env once
+// a previously started load has finished, and nil while it's in progress.
+func exportAsync(currentEnv, previousEnv Env, toLoad string, config *Config) (newEnv Env, err error) {
+	job, err := newAsyncJob(config, toLoad, previousEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := job.Result(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	if result == nil {
+		if !job.Running() {
+			logStatus(currentEnv, "loading %s in the background", toLoad)
+			err = job.Start(currentEnv, toLoad, config)
+		}
+		return nil, err
+	}
+
+	newEnv = result.Diff.Patch(previousEnv)
+	newEnv[DIRENV_DIFF] = previousEnv.Diff(newEnv).Serialize()
+
+	if result.Error != "" {
+		err = errors.New(result.Error)
+	} else if result.EvalError != "" {
+		err = evalError{errors.New(result.EvalError)}
+	}
+	return newEnv, err
+}
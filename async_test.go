@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/direnv/direnv/v2/gzenv"
+)
+
+func setupAsyncTest(t *testing.T) (config *Config, rcPath string) {
+	dir, err := ioutil.TempDir("", "direnv-async")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	rcPath = filepath.Join(dir, ".envrc")
+	if err = ioutil.WriteFile(rcPath, []byte("export FOO=bar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The load itself is not tested here, only that it's started once
+	selfPath, err := exec.LookPath("true")
+	if err != nil {
+		t.Skip("true is not in PATH")
+	}
+
+	config = &Config{
+		CacheDir: filepath.Join(dir, "cache"),
+		SelfPath: selfPath,
+		WorkDir:  dir,
+	}
+	if err = os.MkdirAll(config.JobsDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return config, rcPath
+}
+
+// deadPID returns the PID of a process that has exited
+func deadPID(t *testing.T) int {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip("true can't be run")
+	}
+	return cmd.Process.Pid
+}
+
+func writeClaim(t *testing.T, job *asyncJob, content string, age time.Duration) {
+	path := job.path(".running")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modtime := time.Now().Add(-age)
+	if err := os.Chtimes(path, modtime, modtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readClaimPID(t *testing.T, job *asyncJob) string {
+	data, err := ioutil.ReadFile(job.path(".running"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestAsyncJobRunning(t *testing.T) {
+	config, _ := setupAsyncTest(t)
+	job := &asyncJob{config.JobsDir(), "key"}
+	self := strconv.Itoa(os.Getpid())
+
+	if job.Running() {
+		t.Error("a job without claim should not be running")
+	}
+
+	cases := []struct {
+		desc    string
+		content string
+		age     time.Duration
+		expect  bool
+	}{
+		{"live process", self + "\n", 0, true},
+		{"dead process", strconv.Itoa(deadPID(t)) + "\n", 0, false},
+		{"starting", "", 0, true},
+		{"abandoned while starting", "", 2 * asyncClaimTimeout, false},
+		{"too old", self + "\n", 2 * asyncJobTTL, false},
+	}
+
+	for _, c := range cases {
+		writeClaim(t, job, c.content, c.age)
+		if got := job.Running(); got != c.expect {
+			t.Errorf("%s: Running() = %v, expected %v", c.desc, got, c.expect)
+		}
+	}
+}
+
+func TestAsyncJobStart(t *testing.T) {
+	config, rcPath := setupAsyncTest(t)
+	self := strconv.Itoa(os.Getpid())
+
+	job, err := newAsyncJob(config, rcPath, Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = job.Start(Env{}, rcPath, config); err != nil {
+		t.Fatal(err)
+	}
+	pid := readClaimPID(t, job)
+	if pid == "" || pid == self {
+		t.Errorf("expected the PID of the load, got %q", pid)
+	}
+
+	for _, c := range []struct {
+		desc    string
+		content string
+		age     time.Duration
+	}{
+		{"live process", self + "\n", 0},
+		{"starting", "", 0},
+	} {
+		writeClaim(t, job, c.content, c.age)
+		if err = job.Start(Env{}, rcPath, config); err != nil {
+			t.Fatalf("%s: %v", c.desc, err)
+		}
+		if got := readClaimPID(t, job); got != strings.TrimSpace(c.content) {
+			t.Errorf("%s: the claim should be kept, got %q", c.desc, got)
+		}
+	}
+
+	for _, c := range []struct {
+		desc    string
+		content string
+		age     time.Duration
+	}{
+		{"dead process", strconv.Itoa(deadPID(t)) + "\n", 0},
+		{"abandoned while starting", "", 2 * asyncClaimTimeout},
+	} {
+		writeClaim(t, job, c.content, c.age)
+		if err = job.Start(Env{}, rcPath, config); err != nil {
+			t.Fatalf("%s: %v", c.desc, err)
+		}
+		if got := readClaimPID(t, job); got == "" || got == strings.TrimSpace(c.content) {
+			t.Errorf("%s: the claim should be taken over, got %q", c.desc, got)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(job.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("leftover temporary file %s", entry.Name())
+		}
+	}
+}
+
+func TestAsyncJobStartConcurrently(t *testing.T) {
+	config, rcPath := setupAsyncTest(t)
+
+	// Each load leaves a line in starts, and outlives the concurrent prompts
+	starts := filepath.Join(config.WorkDir, "starts")
+	config.SelfPath = filepath.Join(config.WorkDir, "direnv")
+	script := "#!/bin/sh\necho started >> " + starts + "\nsleep 1\n"
+	if err := ioutil.WriteFile(config.SelfPath, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := newAsyncJob(config, rcPath, Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeClaim(t, job, strconv.Itoa(deadPID(t))+"\n", 0)
+
+	errs := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			errs <- job.Start(Env{}, rcPath, config)
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err = <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	data, err := ioutil.ReadFile(starts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "started"); n != 1 {
+		t.Errorf("expected the load to be started once, got %d", n)
+	}
+}
+
+func TestAsyncJobResult(t *testing.T) {
+	config, _ := setupAsyncTest(t)
+	job := &asyncJob{config.JobsDir(), "key"}
+
+	var stderr bytes.Buffer
+	result, err := job.Result(&stderr)
+	if result != nil || err != nil {
+		t.Fatalf("expected no result for a job that isn't done, got %v, %v", result, err)
+	}
+
+	writeClaim(t, job, strconv.Itoa(os.Getpid())+"\n", 0)
+	if err = ioutil.WriteFile(job.path(".log"), []byte("direnv: loading .envrc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diff := Env{}.Diff(Env{"FOO": "bar"})
+	if err = job.Finish(&asyncResult{Diff: diff, Error: "exit status 1"}); err != nil {
+		t.Fatal(err)
+	}
+	if job.Running() {
+		t.Error("a finished job should not be running")
+	}
+
+	if result, err = job.Result(&stderr); err != nil {
+		t.Fatal(err)
+	}
+	if result == nil || result.Diff.Next["FOO"] != "bar" || result.Error != "exit status 1" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if stderr.String() != "direnv: loading .envrc\n" {
+		t.Errorf("expected the log of the load, got %q", stderr.String())
+	}
+	for _, ext := range []string{".done", ".log", ".running"} {
+		if fileExists(job.path(ext)) {
+			t.Errorf("%s should be removed once the result is read", ext)
+		}
+	}
+
+	if err = ioutil.WriteFile(job.path(".done"), []byte(gzenv.Marshal(&asyncResult{})), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = job.Result(&stderr); err == nil {
+		t.Error("expected an error for a result without diff")
+	}
+}
+
+func TestExportAsync(t *testing.T) {
+	config, rcPath := setupAsyncTest(t)
+	previousEnv := Env{"KEEP": "1"}
+	currentEnv := Env{"KEEP": "1"}
+
+	job, err := newAsyncJob(config, rcPath, previousEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first prompt starts the load
+	newEnv, err := exportAsync(currentEnv, previousEnv, rcPath, config)
+	if newEnv != nil || err != nil {
+		t.Fatalf("expected nothing while loading, got %v, %v", newEnv, err)
+	}
+	if !fileExists(job.path(".running")) {
+		t.Fatal("the job should be claimed")
+	}
+
+	// The next ones wait for it
+	writeClaim(t, job, strconv.Itoa(os.Getpid())+"\n", 0)
+	if newEnv, err = exportAsync(currentEnv, previousEnv, rcPath, config); newEnv != nil || err != nil {
+		t.Fatalf("expected nothing while loading, got %v, %v", newEnv, err)
+	}
+	if got := readClaimPID(t, job); got != strconv.Itoa(os.Getpid()) {
+		t.Errorf("a running job should not be started again, got %q", got)
+	}
+
+	// Until the result is there
+	diff := previousEnv.Diff(Env{"KEEP": "1", "FOO": "bar"})
+	if err = job.Finish(&asyncResult{Diff: diff, Error: "exit status 1"}); err != nil {
+		t.Fatal(err)
+	}
+	newEnv, err = exportAsync(currentEnv, previousEnv, rcPath, config)
+	if err == nil || err.Error() != "exit status 1" {
+		t.Errorf("expected the error of the load, got %v", err)
+	}
+	if newEnv["FOO"] != "bar" || newEnv["KEEP"] != "1" {
+		t.Errorf("expected the loaded env, got %v", newEnv)
+	}
+	if newEnv[DIRENV_DIFF] == "" {
+		t.Error("expected DIRENV_DIFF to be set")
+	}
+
+	// A changed .envrc is a different job
+	if err = ioutil.WriteFile(rcPath, []byte("export FOO=baz\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	other, err := newAsyncJob(config, rcPath, previousEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.key == job.key {
+		t.Error("expected a new job key when the .envrc changes")
+	}
+
+	// Moving to a subdirectory is the same job
+	moved := previousEnv.Copy()
+	moved["PWD"], moved["OLDPWD"] = filepath.Join(config.WorkDir, "sub"), config.WorkDir
+	if same, err := newAsyncJob(config, rcPath, moved); err != nil || same.key != other.key {
+		t.Errorf("expected the same job key in a subdirectory, got %v", err)
+	}
+
+	// A failing .envrc is told apart from a failing load
+	if err = other.Finish(&asyncResult{Diff: previousEnv.Diff(previousEnv), EvalError: "exit status 3"}); err != nil {
+		t.Fatal(err)
+	}
+	newEnv, err = exportAsync(currentEnv, previousEnv, rcPath, config)
+	if !isEvalError(err) || err.Error() != "evaluation failed: exit status 3" {
+		t.Errorf("expected the failure of the .envrc, got %v", err)
+	}
+	if newEnv == nil {
+		t.Error("expected the env to be delivered when the .envrc fails")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CmdAsyncLoad is `direnv async-load JOB PATH`
+var CmdAsyncLoad = &Cmd{
+	Name:    "async-load",
+	Desc:    "Loads an .envrc in the background on behalf of export",
+	Args:    []string{"JOB", "PATH"},
+	Private: true,
+	Action:  actionWithConfig(cmdAsyncLoadAction),
+}
+
+func cmdAsyncLoadAction(env Env, args []string, config *Config) (err error) {
+	if len(args) < 3 {
+		return fmt.Errorf("missing JOB and PATH arguments")
+	}
+
+	job := &asyncJob{config.JobsDir(), args[1]}
+	result := &asyncResult{}
+
+	previousEnv, err := config.Revert(env)
+	if err != nil {
+		result.Error = fmt.Sprintf("Revert() failed: %v", err)
+		return job.Finish(result)
+	}
+
+	newEnv, err := config.EnvFromRC(args[2], previousEnv)
+	var evalErr evalError
+	if errors.As(err, &evalErr) {
+		result.EvalError = evalErr.err.Error()
+	} else if err != nil {
+		result.Error = err.Error()
+	}
+	if newEnv == nil {
+		// Same as a synchronous load, without a timestamp to record there is
+		// nothing to hand over.
+		newEnv = previousEnv
+	}
+
+	result.Diff = previousEnv.Diff(newEnv)
+	delete(result.Diff.Prev, DIRENV_DIFF)
+	delete(result.Diff.Next, DIRENV_DIFF)
+
+	return job.Finish(result)
+}
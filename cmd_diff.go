@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// CmdDiff is `direnv diff [--json]`
+var CmdDiff = &Cmd{
+	Name:   "diff",
+	Desc:   "Shows the variables changed by the loaded .envrc, with their old and new values",
+	Args:   []string{"[--json]"},
+	Action: actionWithConfig(cmdDiffAction),
+}
+
+func cmdDiffAction(env Env, args []string, config *Config) (err error) {
+	var asJSON bool
+	for _, arg := range args[1:] {
+		if arg != "--json" {
+			return fmt.Errorf("unexpected argument '%s'", arg)
+		}
+		asJSON = true
+	}
+
+	diff := NewEnvDiff()
+	if env[DIRENV_DIFF] != "" {
+		if diff, err = LoadEnvDiff(env[DIRENV_DIFF]); err != nil {
+			return fmt.Errorf("invalid DIRENV_DIFF: %w", err)
+		}
+	}
+
+	pathLists := config.PathListPolicy()
+	changes := newEnvChanges(diff, config.Secrets(env, diff.Prev), pathLists)
+
+	if asJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(changes)
+	}
+	printEnvChanges(os.Stdout, changes, pathLists)
+	return nil
+}
+
+// envChange is the change of a single variable. Added and Removed are the
+// entries of the path lists, like PATH.
+type envChange struct {
+	Key     string   `json:"key"`
+	Change  string   `json:"change"`
+	Old     *string  `json:"old,omitempty"`
+	New     *string  `json:"new,omitempty"`
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// newEnvChanges lists the changes of the diff, sorted by key, leaving out
+// the direnv variables. The secret values are redacted.
+func newEnvChanges(diff *EnvDiff, secrets *secretPolicy, pathLists *pathListPolicy) []*envChange {
+	keys := make(map[string]bool)
+	for key := range diff.Prev {
+		keys[key] = true
+	}
+	for key := range diff.Next {
+		keys[key] = true
+	}
+
+	changes := make([]*envChange, 0, len(keys))
+	for key := range keys {
+		if direnvKey(key) {
+			continue
+		}
+
+		c := &envChange{Key: key}
+		oldValue, hadOld := diff.Prev[key]
+		newValue, hasNew := diff.Next[key]
+		switch {
+		case !hadOld:
+			c.Change = "added"
+		case !hasNew:
+			c.Change = "removed"
+		default:
+			c.Change = "modified"
+		}
+
+		if secrets.IsSecret(key) {
+			oldValue, newValue = secrets.Redact(key, oldValue), secrets.Redact(key, newValue)
+		} else if pathLists.IsPathList(key) {
+			c.Added, c.Removed = pathListChanges(oldValue, newValue)
+		}
+		if hadOld {
+			c.Old = &oldValue
+		}
+		if hasNew {
+			c.New = &newValue
+		}
+
+		changes = append(changes, c)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// pathListChanges returns the entries that are only in the new list, and the
+// ones that are only in the old list.
+func pathListChanges(oldValue, newValue string) (added, removed []string) {
+	split := func(value string) (list []string, set map[string]bool) {
+		set = make(map[string]bool)
+		if value == "" {
+			return
+		}
+		list = filepath.SplitList(value)
+		for _, entry := range list {
+			set[entry] = true
+		}
+		return
+	}
+	oldList, oldSet := split(oldValue)
+	newList, newSet := split(newValue)
+
+	for _, entry := range newList {
+		if !oldSet[entry] {
+			added = append(added, entry)
+		}
+	}
+	for _, entry := range oldList {
+		if !newSet[entry] {
+			removed = append(removed, entry)
+		}
+	}
+	return
+}
+
+func printEnvChanges(w io.Writer, changes []*envChange, pathLists *pathListPolicy) {
+	signs := map[string]string{"added": "+", "removed": "-", "modified": "~"}
+
+	for _, c := range changes {
+		fmt.Fprintf(w, "%s%s\n", signs[c.Change], c.Key)
+
+		if c.Added != nil || c.Removed != nil {
+			for _, entry := range c.Added {
+				fmt.Fprintf(w, "  + %s\n", entry)
+			}
+			for _, entry := range c.Removed {
+				fmt.Fprintf(w, "  - %s\n", entry)
+			}
+			continue
+		}
+		if c.Old != nil && c.New != nil && *c.Old != *c.New && pathLists.IsPathList(c.Key) {
+			fmt.Fprintf(w, "  (reordered)\n")
+			continue
+		}
+
+		if c.Old != nil {
+			fmt.Fprintf(w, "  - %s\n", *c.Old)
+		}
+		if c.New != nil {
+			fmt.Fprintf(w, "  + %s\n", *c.New)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEnvChanges(t *testing.T) {
+	diff := &EnvDiff{
+		Prev: map[string]string{"PATH": "/usr/bin:/old", "FOO": "a", "GONE": "x", "DIRENV_DIR": "-/a"},
+		Next: map[string]string{"PATH": "/new:/usr/bin", "FOO": "b", "API_TOKEN": "t", "DIRENV_DIR": "-/b"},
+	}
+	changes := newEnvChanges(diff, newSecretPolicy(defaultSecretPatterns), newPathListPolicy(defaultPathLists))
+
+	var out bytes.Buffer
+	printEnvChanges(&out, changes, newPathListPolicy(defaultPathLists))
+
+	expected := `+API_TOKEN
+  + ***
+~FOO
+  - a
+  + b
+-GONE
+  - x
+~PATH
+  + /new
+  - /old
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	toml "github.com/BurntSushi/toml"
+	"github.com/direnv/direnv/v2/xdg"
+)
+
+// CmdDoctor is `direnv doctor [SHELL]`
+var CmdDoctor = &Cmd{
+	Name:   "doctor",
+	Desc:   "Checks the direnv setup and explains how to fix the problems found",
+	Args:   []string{"[SHELL]"},
+	Action: actionSimple(cmdDoctorAction),
+}
+
+// The outcomes of a check
+const (
+	doctorOK   = "ok"
+	doctorWarn = "warn"
+	doctorFail = "FAIL"
+)
+
+// doctorResult is the outcome of a check. Fix tells the user what to do
+// about a warning or a failure.
+type doctorResult struct {
+	Name    string
+	Outcome string
+	Msg     string
+	Fix     string
+}
+
+func doctorOk(msg string, a ...interface{}) *doctorResult {
+	return &doctorResult{Outcome: doctorOK, Msg: fmt.Sprintf(msg, a...)}
+}
+
+func doctorProblem(outcome, fix, msg string, a ...interface{}) *doctorResult {
+	return &doctorResult{Outcome: outcome, Msg: fmt.Sprintf(msg, a...), Fix: fix}
+}
+
+func cmdDoctorAction(env Env, args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("unexpected argument '%s'", args[2])
+	}
+	target := env["SHELL"]
+	if len(args) > 1 {
+		target = args[1]
+	}
+
+	config, configResult := doctorConfig(env)
+	configResult.Name = "config"
+	results := []*doctorResult{configResult}
+
+	add := func(name string, r *doctorResult) {
+		r.Name = name
+		results = append(results, r)
+	}
+	add("hook", doctorHook(env, target))
+	add("env", doctorEnvState(env))
+	if config == nil {
+		add("bash", doctorProblem(doctorWarn, "fix the config first", "skipped"))
+		add("allow dir", doctorProblem(doctorWarn, "fix the config first", "skipped"))
+		add("binary", doctorProblem(doctorWarn, "fix the config first", "skipped"))
+	} else {
+		add("bash", doctorBash(config.BashPath))
+		add("allow dir", doctorAllowDir(config.AllowDir()))
+		add("binary", doctorBinary(config.SelfPath))
+	}
+
+	if printDoctor(os.Stdout, results) {
+		return exitStatus(1)
+	}
+	return nil
+}
+
+// printDoctor prints the results and returns true if any of the checks failed
+func printDoctor(w io.Writer, results []*doctorResult) (failed bool) {
+	for _, r := range results {
+		fmt.Fprintf(w, "%-4s %s: %s\n", r.Outcome, r.Name, r.Msg)
+		if r.Fix != "" {
+			fmt.Fprintf(w, "     fix: %s\n", r.Fix)
+		}
+		failed = failed || r.Outcome == doctorFail
+	}
+	return
+}
+
+// doctorConfig loads the config, and also reports the keys of the
+// direnv.toml that direnv doesn't know about.
+func doctorConfig(env Env) (*Config, *doctorResult) {
+	config, err := LoadConfig(env)
+	if err != nil {
+		var (
+			pathErr *os.PathError
+			execErr *exec.Error
+		)
+		switch {
+		case errors.As(err, &execErr):
+			return nil, doctorProblem(doctorFail, "install bash, or set bash_path in direnv.toml", "%v", err)
+		case errors.As(err, &pathErr):
+			return nil, doctorProblem(doctorFail, fmt.Sprintf("make %s readable by you", pathErr.Path), "%v", err)
+		case config != nil && config.TomlPath != "":
+			return nil, doctorProblem(doctorFail, fmt.Sprintf("fix the syntax of %s, see direnv.toml(1)", config.TomlPath), "%v", err)
+		}
+		return nil, doctorProblem(doctorFail, "", "%v", err)
+	}
+
+	if config.TomlPath == "" {
+		return config, doctorOk("no direnv.toml in %s, using the defaults", config.ConfDir)
+	}
+
+	var global tomlGlobal
+	md, err := toml.DecodeFile(config.TomlPath, &tomlConfig{tomlGlobal: &global, Global: &global})
+	if err != nil {
+		return config, doctorProblem(doctorFail, "", "%v", err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		sort.Strings(keys)
+		return config, doctorProblem(doctorWarn, "check their spelling against direnv.toml(1)",
+			"unknown keys in %s: %s", config.TomlPath, strings.Join(keys, ", "))
+	}
+	return config, doctorOk("loaded %s", config.TomlPath)
+}
+
+// doctorHookSetup is where each shell looks for the hook, and what to add
+type doctorHookSetup struct {
+	files  []string
+	marker string
+	line   string
+}
+
+func doctorHookSetups(env Env) map[string]doctorHookSetup {
+	home := env["HOME"]
+	zdotdir := env.Fetch("ZDOTDIR", home)
+	fishDir := xdg.ConfigDir(env, "fish")
+	fishConfs, _ := filepath.Glob(filepath.Join(fishDir, "conf.d", "*.fish"))
+	nushellDir := xdg.ConfigDir(env, "nushell")
+
+	return map[string]doctorHookSetup{
+		"bash": {
+			files:  []string{filepath.Join(home, ".bashrc"), filepath.Join(home, ".bash_profile"), filepath.Join(home, ".profile")},
+			marker: "direnv hook bash",
+			line:   `eval "$(direnv hook bash)"`,
+		},
+		"zsh": {
+			files:  []string{filepath.Join(zdotdir, ".zshrc")},
+			marker: "direnv hook zsh",
+			line:   `eval "$(direnv hook zsh)"`,
+		},
+		"fish": {
+			files:  append([]string{filepath.Join(fishDir, "config.fish")}, fishConfs...),
+			marker: "direnv hook fish",
+			line:   "direnv hook fish | source",
+		},
+		"tcsh": {
+			files:  []string{filepath.Join(home, ".tcshrc"), filepath.Join(home, ".cshrc")},
+			marker: "direnv hook tcsh",
+			line:   "eval `direnv hook tcsh`",
+		},
+		"elvish": {
+			files:  []string{filepath.Join(home, ".elvish", "rc.elv"), filepath.Join(xdg.ConfigDir(env, "elvish"), "rc.elv")},
+			marker: "use direnv",
+			line:   "use direnv",
+		},
+		"nu": {
+			files:  []string{filepath.Join(nushellDir, "config.nu")},
+			marker: "direnv.nu",
+			line:   "source " + filepath.Join(nushellDir, "direnv.nu"),
+		},
+		"pwsh": {
+			files:  []string{filepath.Join(xdg.ConfigDir(env, "powershell"), "Microsoft.PowerShell_profile.ps1")},
+			marker: "direnv hook pwsh",
+			line:   "Invoke-Expression (& direnv hook pwsh | Out-String)",
+		},
+		"xonsh": {
+			files:  []string{filepath.Join(home, ".xonshrc"), filepath.Join(xdg.ConfigDir(env, "xonsh"), "rc.xsh")},
+			marker: "direnv hook xonsh",
+			line:   "execx($(direnv hook xonsh))",
+		},
+	}
+}
+
+// doctorHook looks for the hook in the startup files of the shell. The hook
+// lives in the shell itself so it can't be seen from here, unless it has
+// already loaded an .envrc.
+func doctorHook(env Env, target string) *doctorResult {
+	if env[DIRENV_DIR] != "" {
+		return doctorOk("the hook has loaded %s in this shell", filepath.Join(strings.TrimPrefix(env[DIRENV_DIR], "-"), ".envrc"))
+	}
+	if target == "" {
+		return doctorProblem(doctorWarn, "run `direnv doctor SHELL`", "$SHELL is not set, can't tell which shell to check")
+	}
+
+	name := filepath.Base(target)
+	name = strings.TrimPrefix(name, "-")
+	switch name {
+	case "nushell":
+		name = "nu"
+	case "powershell":
+		name = "pwsh"
+	}
+	if DetectShell(name) == nil {
+		return doctorProblem(doctorFail, "see `direnv help` for the supported shells", "unknown shell '%s'", name)
+	}
+	setup, ok := doctorHookSetups(env)[name]
+	if !ok {
+		return doctorOk("%s has no startup file to check, see the direnv(1) SETUP section", name)
+	}
+
+	for _, file := range setup.files {
+		data, err := ioutil.ReadFile(file)
+		if err == nil && strings.Contains(string(data), setup.marker) {
+			return doctorOk("found `%s` in %s", setup.marker, file)
+		}
+	}
+	return doctorProblem(doctorWarn,
+		fmt.Sprintf("add `%s` at the end of %s, see the direnv(1) SETUP section", setup.line, setup.files[0]),
+		"`%s` not found in %s", setup.marker, strings.Join(setup.files, ", "))
+}
+
+// doctorEnvState checks that the state left in the env by the last load can
+// be read by this version of direnv.
+func doctorEnvState(env Env) *doctorResult {
+	const fix = "unset DIRENV_DIR, DIRENV_DIFF and DIRENV_WATCHES, or open a new shell"
+
+	if env[DIRENV_DIFF] == "" && env[DIRENV_DIR] == "" {
+		return doctorOk("no .envrc loaded")
+	}
+	if env[DIRENV_DIFF] != "" {
+		if _, err := LoadEnvDiff(env[DIRENV_DIFF]); err != nil {
+			return doctorProblem(doctorFail, fix,
+				"DIRENV_DIFF can't be read, it was probably set by another version of direnv: %v", err)
+		}
+	}
+	if env[DIRENV_WATCHES] != "" {
+		times := NewFileTimes()
+		if err := times.Unmarshal(env[DIRENV_WATCHES]); err != nil {
+			return doctorProblem(doctorFail, fix,
+				"DIRENV_WATCHES can't be read, it was probably set by another version of direnv: %v", err)
+		}
+	}
+	if env[DIRENV_DIFF] == "" || env[DIRENV_DIR] == "" {
+		return doctorProblem(doctorWarn, fix, "only one of DIRENV_DIR and DIRENV_DIFF is set")
+	}
+	return doctorOk("the state of the loaded .envrc is readable")
+}
+
+// doctorBash checks that bash runs. The trace used by `direnv profile` and
+// `direnv why` needs bash 5.
+func doctorBash(bashPath string) *doctorResult {
+	const fix = "install a newer bash and set bash_path in direnv.toml"
+
+	out, err := exec.Command(bashPath, "-c", `echo "${BASH_VERSINFO[0]} $BASH_VERSION"`).Output()
+	if err != nil {
+		return doctorProblem(doctorFail, "install bash, or set bash_path in direnv.toml", "can't run %s: %v", bashPath, err)
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return doctorProblem(doctorFail, fix, "%s doesn't look like bash", bashPath)
+	}
+	major, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return doctorProblem(doctorFail, fix, "%s doesn't look like bash", bashPath)
+	}
+	if major < 5 {
+		return doctorProblem(doctorWarn, fix,
+			"%s is bash %s, `direnv profile` and `direnv why` need bash 5 or later", bashPath, fields[1])
+	}
+	return doctorOk("%s is bash %s", bashPath, fields[1])
+}
+
+// doctorAllowDir checks that the allow files can be written and read, and
+// that nobody else can allow an .envrc on your behalf.
+func doctorAllowDir(allowDir string) *doctorResult {
+	fi, err := os.Stat(allowDir)
+	if os.IsNotExist(err) {
+		return doctorOk("%s will be created by the first `direnv allow`", allowDir)
+	}
+	if err != nil {
+		return doctorProblem(doctorFail, "", "%v", err)
+	}
+	if !fi.IsDir() {
+		return doctorProblem(doctorFail, fmt.Sprintf("move %s out of the way", allowDir), "%s is not a directory", allowDir)
+	}
+	if fi.Mode().Perm()&0022 != 0 {
+		return doctorProblem(doctorFail, fmt.Sprintf("chmod go-w %s", allowDir),
+			"%s is writable by other users, who could allow any .envrc", allowDir)
+	}
+
+	if !writable(allowDir) {
+		return doctorProblem(doctorFail, fmt.Sprintf("chown -R $(id -un) %s", allowDir), "%s is not writable", allowDir)
+	}
+
+	files, err := ioutil.ReadDir(allowDir)
+	if err != nil {
+		return doctorProblem(doctorFail, fmt.Sprintf("chmod u+rx %s", allowDir), "%v", err)
+	}
+	var unreadable []string
+	for _, file := range files {
+		path := filepath.Join(allowDir, file.Name())
+		if f, err := os.Open(path); err != nil {
+			unreadable = append(unreadable, path)
+		} else {
+			f.Close()
+		}
+	}
+	if len(unreadable) > 0 {
+		return doctorProblem(doctorFail, fmt.Sprintf("chown -R $(id -un) %s", allowDir),
+			"%d allow files can't be read, their .envrc are blocked: %s", len(unreadable), strings.Join(unreadable, ", "))
+	}
+	return doctorOk("%s is writable, with %d allowed .envrc", allowDir, len(files))
+}
+
+// doctorBinary checks that the direnv found in PATH is this one, since the
+// hook and the commands typed by the user might run different versions.
+func doctorBinary(selfPath string) *doctorResult {
+	pathDirenv, err := exec.LookPath("direnv")
+	if err != nil {
+		return doctorProblem(doctorWarn, fmt.Sprintf("add %s to PATH", filepath.Dir(selfPath)), "direnv is not in PATH")
+	}
+
+	resolve := func(path string) string {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return resolved
+		}
+		return path
+	}
+	if resolve(pathDirenv) == resolve(selfPath) {
+		return doctorOk("%s is direnv %s", selfPath, Version)
+	}
+
+	other := "unknown"
+	if out, err := exec.Command(pathDirenv, "version").Output(); err == nil {
+		other = strings.TrimSpace(string(out))
+	}
+	return doctorProblem(doctorWarn, "remove one of them, or reorder PATH",
+		"%s (version %s) comes first in PATH, this is %s (version %s)", pathDirenv, other, selfPath, Version)
+}
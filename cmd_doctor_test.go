@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDoctorEnvState(t *testing.T) {
+	diff := NewEnvDiff()
+	tests := []struct {
+		env     Env
+		outcome string
+	}{
+		{Env{}, doctorOK},
+		{Env{DIRENV_DIR: "-/a", DIRENV_DIFF: diff.Serialize()}, doctorOK},
+		{Env{DIRENV_DIR: "-/a", DIRENV_DIFF: "garbage"}, doctorFail},
+		{Env{DIRENV_DIR: "-/a", DIRENV_DIFF: diff.Serialize(), DIRENV_WATCHES: "garbage"}, doctorFail},
+		{Env{DIRENV_DIR: "-/a"}, doctorWarn},
+	}
+	for _, test := range tests {
+		if r := doctorEnvState(test.env); r.Outcome != test.outcome {
+			t.Errorf("%v: expected %s, got %s: %s", test.env, test.outcome, r.Outcome, r.Msg)
+		}
+	}
+}
+
+func TestDoctorAllowDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "direnv-doctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	allowDir := filepath.Join(root, "allow")
+
+	if r := doctorAllowDir(allowDir); r.Outcome != doctorOK {
+		t.Errorf("missing dir: expected ok, got %s: %s", r.Outcome, r.Msg)
+	}
+
+	if err = os.Mkdir(allowDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	// An old modification time shows if anything gets written in the dir
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err = os.Chtimes(allowDir, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if r := doctorAllowDir(allowDir); r.Outcome != doctorOK {
+		t.Errorf("expected ok, got %s: %s", r.Outcome, r.Msg)
+	}
+	if fi, err := os.Stat(allowDir); err != nil || !fi.ModTime().Equal(old) {
+		t.Error("the allow dir should be left untouched")
+	}
+
+	// root can write anyway
+	if os.Geteuid() != 0 {
+		if err = os.Chmod(allowDir, 0500); err != nil {
+			t.Fatal(err)
+		}
+		if r := doctorAllowDir(allowDir); r.Outcome != doctorFail {
+			t.Errorf("read-only: expected FAIL, got %s: %s", r.Outcome, r.Msg)
+		}
+	}
+
+	if err = os.Chmod(allowDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if r := doctorAllowDir(allowDir); r.Outcome != doctorFail {
+		t.Errorf("world writable: expected FAIL, got %s: %s", r.Outcome, r.Msg)
+	}
+}
+
+func TestDoctorHookSetupsNushell(t *testing.T) {
+	setup := doctorHookSetups(Env{"HOME": "/home/u", "XDG_CONFIG_HOME": "/conf"})["nu"]
+	if setup.files[0] != "/conf/nushell/config.nu" || setup.line != "source /conf/nushell/direnv.nu" {
+		t.Errorf("expected the nushell files in XDG_CONFIG_HOME, got %v and %q", setup.files, setup.line)
+	}
+}
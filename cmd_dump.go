@@ -46,7 +46,19 @@ func cmdDumpAction(env Env, args []string) (err error) {
 		return fmt.Errorf("unknown target shell '%s'", target)
 	}
 
-	_, err = fmt.Fprintln(w, shell.Dump(env))
+	e := make(ShellExport, len(env))
+	for key, value := range env {
+		e.Add(key, value)
+	}
+	if shell, e, err = prepareExport(shell, e); err != nil {
+		return
+	}
+	dumped := make(Env, len(e))
+	for key, value := range e {
+		dumped[key] = *value
+	}
+
+	_, err = fmt.Fprintln(w, shell.Dump(dumped))
 
 	return
 }
@@ -53,7 +53,8 @@ func cmdExecAction(env Env, args []string, config *Config) (err error) {
 
 	// Load the rc
 	if toLoad := findUp(rcPath, ".envrc"); toLoad != "" {
-		if newEnv, err = config.EnvFromRC(toLoad, previousEnv); err != nil {
+		// The command is run even if the .envrc failed, with what it left
+		if newEnv, err = config.EnvFromRC(toLoad, previousEnv); err != nil && !isEvalError(err) {
 			return
 		}
 	} else {
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// CmdExpireAfter is `direnv expire-after SHELL DURATION`
+var CmdExpireAfter = &Cmd{
+	Name:    "expire-after",
+	Desc:    "Marks the loaded environment as stale once DURATION has elapsed",
+	Args:    []string{"SHELL", "DURATION"},
+	Private: true,
+	Action:  actionSimple(expireAfterCommand),
+}
+
+func expireAfterCommand(env Env, args []string) (err error) {
+	if len(args) < 3 {
+		return fmt.Errorf("a duration is required to set the expiry")
+	}
+
+	shellName := args[1]
+
+	shell := DetectShell(shellName)
+
+	if shell == nil {
+		return fmt.Errorf("unknown target shell '%s'", shellName)
+	}
+
+	duration, err := time.ParseDuration(args[2])
+	if err != nil {
+		return fmt.Errorf("invalid duration '%s': %w", args[2], err)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("duration '%s' must be positive", args[2])
+	}
+
+	watches := NewFileTimes()
+	watchString, ok := env[DIRENV_WATCHES]
+	if ok {
+		err = watches.Unmarshal(watchString)
+		if err != nil {
+			return err
+		}
+	}
+
+	watches.Expire(time.Now().Add(duration))
+
+	e := make(ShellExport)
+	e.Add(DIRENV_WATCHES, watches.Marshal())
+
+	os.Stdout.WriteString(shell.Export(e))
+
+	return
+}
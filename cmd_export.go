@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
 // CmdExport is `direnv export $0`
@@ -13,10 +16,13 @@ var CmdExport = &Cmd{
 	Desc:    "loads an .envrc and prints the diff in terms of exports",
 	Args:    []string{"SHELL"},
 	Private: true,
-	Action:  cmdWithWarnTimeout(actionWithConfig(exportCommand)),
+	Action:  actionSimple(exportCommand),
 }
 
-func exportCommand(currentEnv Env, args []string, config *Config) (err error) {
+// exportCommand runs on every prompt. To keep it fast, it first works out
+// whether there is anything to do from the env alone, and only loads the
+// config when an .envrc has to be loaded or unloaded.
+func exportCommand(currentEnv Env, args []string) (err error) {
 	defer log.SetPrefix(log.Prefix())
 	log.SetPrefix(log.Prefix() + "export:")
 	logDebug("start")
@@ -32,9 +38,32 @@ func exportCommand(currentEnv Env, args []string, config *Config) (err error) {
 		return fmt.Errorf("unknown target shell '%s'", target)
 	}
 
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("Getwd failed: %w", err)
+	}
+
+	toLoad, update := exportUpdateNeeded(currentEnv, wd)
+	if !update {
+		return
+	}
+
+	load := actionWithConfig(func(env Env, args []string, config *Config) error {
+		return exportLoad(env, shell, toLoad, config)
+	})
+	return cmdWithWarnTimeout(load).Call(currentEnv, args, nil)
+}
+
+// exportUpdateNeeded compares the .envrc recorded in the env with the one
+// found from wd, and returns the latter if it needs to be loaded. An empty
+// toLoad with update set means that the env has to be unloaded.
+func exportUpdateNeeded(env Env, wd string) (toLoad string, update bool) {
 	logDebug("loading RCs")
-	loadedRC := config.LoadedRC()
-	toLoad := findUp(config.WorkDir, ".envrc")
+	var loadedRC *RC
+	if rcDir := strings.TrimPrefix(env[DIRENV_DIR], "-"); rcDir != "" {
+		loadedRC = RCFromEnv(filepath.Join(rcDir, ".envrc"), env[DIRENV_WATCHES], nil)
+	}
+	toLoad = findUp(wd, ".envrc")
 
 	if loadedRC == nil && toLoad == "" {
 		return
@@ -54,15 +83,41 @@ func exportCommand(currentEnv Env, args []string, config *Config) (err error) {
 		logDebug("no RC (implies no DIRENV_DIFF),loading")
 	case loadedRC.path != toLoad:
 		logDebug("new RC, loading")
-	case loadedRC.times.Check() != nil:
+	case watchesChanged(env, loadedRC):
 		logDebug("file changed, reloading")
 	default:
 		logDebug("no update needed")
 		return
 	}
 
+	return toLoad, true
+}
+
+// exportLoad loads or unloads the .envrc and prints the diff for the shell
+func exportLoad(currentEnv Env, shell Shell, toLoad string, config *Config) (err error) {
 	var previousEnv, newEnv Env
 
+	start := time.Now()
+	event, dir := "load", filepath.Dir(toLoad)
+	if toLoad == "" {
+		event, dir = "unload", strings.TrimPrefix(currentEnv[DIRENV_DIR], "-")
+	} else if currentEnv[DIRENV_DIR] == "-"+dir {
+		event = "reload"
+	}
+
+	// evalErr is a failure of the .envrc, whose diff is delivered anyway
+	var evalErr error
+	defer func() {
+		// Loads still running in the background are recorded once they're over
+		if (newEnv != nil || err != nil) && dir != "" {
+			logErr := err
+			if logErr == nil {
+				logErr = evalErr
+			}
+			logLoad(config, event, dir, start, logErr)
+		}
+	}()
+
 	if previousEnv, err = config.Revert(currentEnv); err != nil {
 		err = fmt.Errorf("Revert() failed: %w", err)
 		logDebug("err: %v", err)
@@ -73,8 +128,26 @@ func exportCommand(currentEnv Env, args []string, config *Config) (err error) {
 		logStatus(currentEnv, "unloading")
 		newEnv = previousEnv.Copy()
 		newEnv.CleanContext()
+	} else if config.AsyncLoad {
+		newEnv, err = exportAsync(currentEnv, previousEnv, toLoad, config)
+		if isEvalError(err) {
+			evalErr, err = err, nil
+		}
+		if newEnv == nil {
+			if err != nil || currentEnv[DIRENV_DIR] == "-"+filepath.Dir(toLoad) {
+				// Keep the current env until the reload is over
+				return
+			}
+			// Unload the previous .envrc while the new one is loading
+			event, dir = "unload", strings.TrimPrefix(currentEnv[DIRENV_DIR], "-")
+			newEnv = previousEnv.Copy()
+			newEnv.CleanContext()
+		}
 	} else {
 		newEnv, err = config.EnvFromRC(toLoad, previousEnv)
+		if isEvalError(err) {
+			evalErr, err = err, nil
+		}
 		if err != nil {
 			logDebug("err: %v", err)
 			// If loading fails, fall through and deliver a diff anyway,
@@ -93,12 +166,33 @@ func exportCommand(currentEnv Env, args []string, config *Config) (err error) {
 		logStatus(currentEnv, "export %s", out)
 	}
 
-	diffString := currentEnv.Diff(newEnv).ToShell(shell)
-	logDebug("env diff %s", diffString)
-	fmt.Print(diffString)
+	diff := currentEnv.Diff(newEnv)
+	secrets := config.Secrets(currentEnv, newEnv)
+	shell = shellWithContext(shell, shellContext{currentEnv, secrets, config.PathListPolicy()})
+	// shellErr leaves the error of the load, if any, to be returned
+	out, shellErr := diff.ToShell(shell)
+	if shellErr != nil {
+		return shellErr
+	}
+	if currentLogLevel >= levelDebug {
+		if redacted, err := secrets.RedactDiff(diff).ToShell(shell); err == nil {
+			logDebug("env diff %s", redacted)
+		}
+	}
+	fmt.Print(out)
 	return
 }
 
+// watchesChanged asks the daemon, if one is running, whether any of the
+// watched files has changed. Otherwise it stats the watches itself.
+func watchesChanged(env Env, rc *RC) bool {
+	if fresh, ok := daemonCheckWatches(env, env[DIRENV_WATCHES]); ok {
+		logDebug("daemon: fresh=%v", fresh)
+		return !fresh
+	}
+	return rc.times.Check() != nil
+}
+
 // Return a string of +/-/~ indicators of an environment diff
 func diffStatus(oldDiff *EnvDiff) string {
 	if oldDiff.Any() {
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupExportBench creates an allowed .envrc that is already loaded in the
+// returned env, and moves into its directory.
+func setupExportBench(b *testing.B) (env Env, cleanup func()) {
+	dir, err := ioutil.TempDir("", "direnv-export")
+	if err != nil {
+		b.Fatal(err)
+	}
+	dir, _ = filepath.EvalSymlinks(dir)
+
+	rcPath := filepath.Join(dir, ".envrc")
+	if err = ioutil.WriteFile(rcPath, []byte("export FOO=bar\n"), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	env = Env{
+		"HOME":            dir,
+		"XDG_CACHE_HOME":  filepath.Join(dir, "cache"),
+		"XDG_CONFIG_HOME": filepath.Join(dir, "config"),
+		"XDG_DATA_HOME":   filepath.Join(dir, "data"),
+	}
+	config := &Config{DataDir: env["XDG_DATA_HOME"]}
+	rc, err := RCFromPath(rcPath, config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err = rc.Allow(); err != nil {
+		b.Fatal(err)
+	}
+	env[DIRENV_DIR] = "-" + dir
+	env[DIRENV_WATCHES] = rc.times.Marshal()
+
+	wd, _ := os.Getwd()
+	if err = os.Chdir(dir); err != nil {
+		b.Fatal(err)
+	}
+
+	return env, func() {
+		_ = os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+// BenchmarkExportNoChange measures what the prompt hook costs when nothing
+// has changed.
+func BenchmarkExportNoChange(b *testing.B) {
+	env, cleanup := setupExportBench(b)
+	defer cleanup()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := exportCommand(env, []string{"direnv export", "json"}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkExportNoChangeWithConfig measures the same check when the config
+// is loaded upfront, which is what the prompt hook used to do.
+func BenchmarkExportNoChangeWithConfig(b *testing.B) {
+	env, cleanup := setupExportBench(b)
+	defer cleanup()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		config, err := LoadConfig(env)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, update := exportUpdateNeeded(env, config.WorkDir); update {
+			b.Fatal("unexpected update")
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// CmdProfile is `direnv profile [--json] [DIR]`
+var CmdProfile = &Cmd{
+	Name:   "profile",
+	Desc:   "Loads the .envrc found in DIR and reports where the time was spent",
+	Args:   []string{"[--json]", "[DIR]"},
+	Action: actionWithConfig(cmdProfileAction),
+}
+
+func cmdProfileAction(env Env, args []string, config *Config) (err error) {
+	var (
+		asJSON bool
+		dir    string
+	)
+	for _, arg := range args[1:] {
+		switch {
+		case arg == "--json":
+			asJSON = true
+		case dir == "":
+			dir = arg
+		default:
+			return fmt.Errorf("unexpected argument '%s'", arg)
+		}
+	}
+	if dir == "" {
+		dir = config.WorkDir
+	}
+
+	rcPath := findUp(dir, ".envrc")
+	if rcPath == "" {
+		return fmt.Errorf(".envrc file not found")
+	}
+	rc, err := RCFromPath(rcPath, config)
+	if err != nil {
+		return
+	}
+
+	previousEnv, err := config.Revert(env)
+	if err != nil {
+		return
+	}
+	previousEnv.CleanContext()
+
+	trace, err := ioutil.TempFile("", "direnv-profile")
+	if err != nil {
+		return
+	}
+	trace.Close()
+	defer os.Remove(trace.Name())
+
+	start := time.Now()
+	_, loadErr := rc.load(previousEnv, trace.Name())
+	end := time.Now()
+
+	traceFile, err := os.Open(trace.Name())
+	if err != nil {
+		return
+	}
+	defer traceFile.Close()
+
+	report, err := newProfileReport(rcPath, traceFile, start, end)
+	if err != nil {
+		return
+	}
+
+	if asJSON {
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		err = e.Encode(report)
+	} else {
+		report.Print(os.Stdout)
+	}
+	if err == nil {
+		err = loadErr
+	}
+	return
+}
+
+// profileEntry is the time spent in a stdlib function, a file or a command
+type profileEntry struct {
+	Name    string  `json:"name"`
+	Seconds float64 `json:"seconds"`
+	Count   int     `json:"count"`
+}
+
+type profileReport struct {
+	RC       string          `json:"rc"`
+	Seconds  float64         `json:"seconds"`
+	Stdlib   []*profileEntry `json:"stdlib"`
+	Files    []*profileEntry `json:"files"`
+	Commands []*profileEntry `json:"commands"`
+}
+
+// stdlibFuncRe matches the function definitions of the stdlib
+var stdlibFuncRe = regexp.MustCompile(`(?m)^\s*([A-Za-z_][A-Za-z0-9_.:-]*)\(\) \{`)
+
+// bashBuiltins are the command names that don't start a process
+var bashBuiltins = map[string]bool{
+	"case": true, "for": true, "select": true,
+	".": true, ":": true, "[": true, "[[": true, "((": true, "alias": true,
+	"bg": true, "bind": true, "break": true, "builtin": true, "caller": true,
+	"cd": true, "command": true, "compgen": true, "complete": true,
+	"continue": true, "declare": true, "dirs": true, "disown": true,
+	"echo": true, "enable": true, "eval": true, "exec": true, "exit": true,
+	"export": true, "false": true, "fc": true, "fg": true, "getopts": true,
+	"hash": true, "help": true, "history": true, "jobs": true, "kill": true,
+	"let": true, "local": true, "logout": true, "mapfile": true, "popd": true,
+	"printf": true, "pushd": true, "pwd": true, "read": true,
+	"readarray": true, "readonly": true, "return": true, "set": true,
+	"shift": true, "shopt": true, "source": true, "test": true, "times": true,
+	"trap": true, "true": true, "type": true, "typeset": true, "ulimit": true,
+	"umask": true, "unalias": true, "unset": true, "wait": true,
+}
+
+// stdlibCall returns the outermost stdlib function that was called from the
+// loaded files. What __main__ and the root source_env do around the loading
+// of the files is left out.
+func stdlibCall(l traceLine, stdlibFuncs map[string]bool) (name string, invoked bool) {
+	funcs := l.funcs
+	if n := len(funcs); n > 0 && funcs[n-1] == "__main__" {
+		funcs = funcs[:n-1]
+		if n := len(funcs); n > 0 && funcs[n-1] == "source_env" {
+			funcs = funcs[:n-1]
+		}
+	}
+	if n := len(funcs); n == 0 || funcs[n-1] != "source" {
+		return "", false
+	}
+	for i := len(funcs) - 1; i >= 0; i-- {
+		if stdlibFuncs[funcs[i]] {
+			return funcs[i], false
+		}
+	}
+	if name = commandName(l.command); stdlibFuncs[name] {
+		return name, true
+	}
+	return "", false
+}
+
+func newProfileReport(rcPath string, trace io.Reader, start, end time.Time) (*profileReport, error) {
+	stdlibFuncs := make(map[string]bool)
+	for _, m := range stdlibFuncRe.FindAllStringSubmatch(StdLib, -1) {
+		stdlibFuncs[m[1]] = true
+	}
+
+	lines, err := readTrace(trace)
+	if err != nil {
+		return nil, err
+	}
+	userFuncs := make(map[string]bool)
+	for _, l := range lines {
+		for _, f := range l.funcs {
+			userFuncs[f] = true
+		}
+	}
+
+	stdlib := make(map[string]*profileEntry)
+	files := make(map[string]*profileEntry)
+	commands := make(map[string]*profileEntry)
+	add := func(entries map[string]*profileEntry, name string, d time.Duration, count int) {
+		e, ok := entries[name]
+		if !ok {
+			e = &profileEntry{Name: name}
+			entries[name] = e
+		}
+		e.Seconds += d.Seconds()
+		e.Count += count
+	}
+
+	// A command is charged with the time until the next one starts
+	for i, l := range lines {
+		next := end
+		if i+1 < len(lines) {
+			next = lines[i+1].time
+		}
+		d := next.Sub(l.time)
+		if d < 0 {
+			d = 0
+		}
+
+		if name, invoked := stdlibCall(l, stdlibFuncs); name != "" {
+			count := 0
+			if invoked {
+				count = 1
+			}
+			add(stdlib, name, d, count)
+		}
+
+		if source := l.source(); source != "" && source != "environment" {
+			add(files, source, d, 1)
+		}
+
+		name := commandName(l.command)
+		if name != "" && !bashBuiltins[name] && !stdlibFuncs[name] && !userFuncs[name] {
+			add(commands, filepath.Base(name), d, 1)
+		}
+	}
+
+	return &profileReport{
+		RC:       rcPath,
+		Seconds:  end.Sub(start).Seconds(),
+		Stdlib:   sortedProfileEntries(stdlib),
+		Files:    sortedProfileEntries(files),
+		Commands: sortedProfileEntries(commands),
+	}, nil
+}
+
+func sortedProfileEntries(entries map[string]*profileEntry) []*profileEntry {
+	list := make([]*profileEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Seconds != list[j].Seconds {
+			return list[i].Seconds > list[j].Seconds
+		}
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Print writes the report for humans
+func (r *profileReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "%s loaded in %.3fs\n", r.RC, r.Seconds)
+
+	section := func(title string, entries []*profileEntry) {
+		if len(entries) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s:\n", title)
+		for _, e := range entries {
+			percent := 0.0
+			if r.Seconds > 0 {
+				percent = 100 * e.Seconds / r.Seconds
+			}
+			fmt.Fprintf(w, "  %8.3fs %5.1f%% %6d  %s\n", e.Seconds, percent, e.Count, e.Name)
+		}
+	}
+	section("stdlib calls", r.Stdlib)
+	section("files", r.Files)
+	section("commands", r.Commands)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileReport(t *testing.T) {
+	trace := strings.Join([]string{
+		"+1000.000000\t/p\t1\t1\t__main__\t/s/stdlib.sh\t0\tsource_env /p/.envrc\tsource_env /p/.envrc",
+		"++1000.100000\t/p\t1\t40 1\tsource source_env __main__\t./.envrc /s/stdlib.sh /s/stdlib.sh\t0\tuse nix\tuse nix",
+		"+++1000.200000\t/p\t90\t1 40 1\tuse source source_env __main__\t/s/stdlib.sh ./.envrc /s/stdlib.sh /s/stdlib.sh\t0\tuse_nix\tuse_nix",
+		"+++1000.300000\t/p\t120\t91 1 40 1\tuse_nix use source source_env __main__\t/s/stdlib.sh /s/stdlib.sh ./.envrc /s/stdlib.sh /s/stdlib.sh\t0\tnix-shell --run \"$cmd\"\t'/bin/nix-shell' --run 'a",
+		"b'",
+		"++1001.300000\t/p\t2\t40 1\tsource source_env __main__\t./.envrc /s/stdlib.sh /s/stdlib.sh\t0\tFOO=1\tFOO=1",
+		"++1001.400000\t/p\t3\t40 1\tsource source_env __main__\t./.envrc /s/stdlib.sh /s/stdlib.sh\t0\tsleep 1\tsleep 1",
+	}, "\n")
+
+	start := time.Unix(999, 0)
+	end := time.Unix(1002, 400000000)
+	report, err := newProfileReport("/p/.envrc", strings.NewReader(trace), start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Seconds != 3.4 {
+		t.Errorf("expected a total of 3.4s, got %v", report.Seconds)
+	}
+
+	expect := func(kind string, entries []*profileEntry, names ...string) {
+		t.Helper()
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name)
+		}
+		if strings.Join(got, " ") != strings.Join(names, " ") {
+			t.Errorf("expected %s %v, got %v", kind, names, got)
+		}
+	}
+	expect("stdlib calls", report.Stdlib, "use")
+	expect("files", report.Files, "/p/.envrc", "/s/stdlib.sh")
+	expect("commands", report.Commands, "nix-shell", "sleep")
+
+	if use := report.Stdlib[0]; use.Count != 1 || use.Seconds < 1.19 || use.Seconds > 1.21 {
+		t.Errorf("unexpected use entry %+v", use)
+	}
+}
@@ -15,12 +15,22 @@ var CmdPrune = &Cmd{
 }
 
 func cmdPruneAction(env Env, args []string, config *Config) (err error) {
+	if err = pruneDir(config.AllowDir()); err != nil {
+		return
+	}
+	if err = pruneDir(config.DenyDir()); os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+// pruneDir removes the records of the .envrc that don't exist anymore
+func pruneDir(allowed string) (err error) {
 	var dir *os.File
 	var fi os.FileInfo
 	var dirList []string
 	var envrc []byte
 
-	allowed := config.AllowDir()
 	if dir, err = os.Open(allowed); err != nil {
 		return err
 	}
@@ -14,10 +14,10 @@ var CmdShowDump = &Cmd{
 	Desc:    "Show the data inside of a dump for debugging purposes",
 	Args:    []string{"DUMP"},
 	Private: true,
-	Action:  actionSimple(cmdShowDumpAction),
+	Action:  actionWithConfig(cmdShowDumpAction),
 }
 
-func cmdShowDumpAction(env Env, args []string) (err error) {
+func cmdShowDumpAction(env Env, args []string, config *Config) (err error) {
 	if len(args) < 2 {
 		return fmt.Errorf("missing DUMP argument")
 	}
@@ -28,7 +28,17 @@ func cmdShowDumpAction(env Env, args []string) (err error) {
 		return err
 	}
 
+	// The variables marked as secret in the dumped env or diff are masked
+	// as well
+	var (
+		dumpedEnv  Env
+		dumpedDiff EnvDiff
+	)
+	_ = gzenv.Unmarshal(args[1], &dumpedEnv)
+	_ = gzenv.Unmarshal(args[1], &dumpedDiff)
+	secrets := config.Secrets(env, dumpedEnv, dumpedDiff.Prev, dumpedDiff.Next)
+
 	e := json.NewEncoder(os.Stdout)
 	e.SetIndent("", "  ")
-	return e.Encode(f)
+	return e.Encode(secrets.RedactAny(f))
 }
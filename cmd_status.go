@@ -1,44 +1,222 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
 )
 
 // CmdStatus is `direnv status`
 var CmdStatus = &Cmd{
-	Name: "status",
-	Desc: "prints some debug status information",
-	Action: actionWithConfig(func(env Env, args []string, config *Config) error {
-		fmt.Println("direnv exec path", config.SelfPath)
-		fmt.Println("DIRENV_CONFIG", config.ConfDir)
-
-		fmt.Println("bash_path", config.BashPath)
-		fmt.Println("disable_stdin", config.DisableStdin)
-		fmt.Println("warn_timeout", config.WarnTimeout)
-		fmt.Println("whitelist.prefix", config.WhitelistPrefix)
-		fmt.Println("whitelist.exact", config.WhitelistExact)
-
-		loadedRC := config.LoadedRC()
-		foundRC, err := config.FindRC()
-		if err != nil {
+	Name:   "status",
+	Desc:   "prints some debug status information",
+	Args:   []string{"[--json]", "[--check]"},
+	Action: actionWithConfig(cmdStatusAction),
+}
+
+// The states reported by `direnv status --check`, and their exit status.
+// These are part of the interface for scripts, so don't renumber them.
+const (
+	statusLoaded   = "loaded"   // 0: the .envrc found is loaded and up to date
+	statusNone     = "none"     // 2: no .envrc found
+	statusBlocked  = "blocked"  // 3: the .envrc found isn't allowed
+	statusDenied   = "denied"   // 4: the .envrc found has been denied
+	statusUnloaded = "unloaded" // 5: the .envrc found isn't the one loaded
+	statusStale    = "stale"    // 6: a file watched by the loaded .envrc changed
+)
+
+var statusExitCodes = map[string]int{
+	statusLoaded:   0,
+	statusNone:     2,
+	statusBlocked:  3,
+	statusDenied:   4,
+	statusUnloaded: 5,
+	statusStale:    6,
+}
+
+type statusReport struct {
+	State  string       `json:"state"`
+	Config statusConfig `json:"config"`
+	Loaded *statusRC    `json:"loaded"`
+	Found  *statusRC    `json:"found"`
+}
+
+type statusConfig struct {
+	SelfPath        string   `json:"self_path"`
+	ConfigDir       string   `json:"config_dir"`
+	TomlPath        string   `json:"toml_path"`
+	BashPath        string   `json:"bash_path"`
+	AsyncLoad       bool     `json:"async_load"`
+	DisableStdin    bool     `json:"disable_stdin"`
+	LogFile         string   `json:"log_file"`
+	QuietLoad       bool     `json:"quiet_load"`
+	StrictEnv       bool     `json:"strict_env"`
+	WarnTimeout     string   `json:"warn_timeout"`
+	WhitelistPrefix []string `json:"whitelist_prefix"`
+	WhitelistExact  []string `json:"whitelist_exact"`
+}
+
+type statusRC struct {
+	Path string `json:"path"`
+	// Allow is only known for the .envrc found on disk
+	Allow   *statusAllow   `json:"allow,omitempty"`
+	Watches []*statusWatch `json:"watches"`
+}
+
+type statusAllow struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+	Path   string `json:"path"`
+}
+
+type statusWatch struct {
+	Path    string `json:"path"`
+	Kind    string `json:"kind,omitempty"`
+	Modtime int64  `json:"modtime"`
+	Exists  bool   `json:"exists"`
+	Stale   bool   `json:"stale"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func cmdStatusAction(env Env, args []string, config *Config) error {
+	var asJSON, check bool
+	for _, arg := range args[1:] {
+		switch arg {
+		case "--json":
+			asJSON = true
+		case "--check":
+			check = true
+		default:
+			return fmt.Errorf("unexpected argument '%s'", arg)
+		}
+	}
+
+	loadedRC := config.LoadedRC()
+	foundRC, err := config.FindRC()
+	if err != nil {
+		return err
+	}
+
+	report := newStatusReport(config, loadedRC, foundRC)
+
+	switch {
+	case asJSON:
+		e := json.NewEncoder(os.Stdout)
+		e.SetIndent("", "  ")
+		if err = e.Encode(report); err != nil {
 			return err
 		}
+	case check:
+		fmt.Println(report.State)
+	default:
+		printStatus(config, loadedRC, foundRC)
+	}
 
-		if loadedRC != nil {
-			formatRC("Loaded", loadedRC)
-		} else {
-			fmt.Println("No .envrc loaded")
+	if check {
+		if code := statusExitCodes[report.State]; code != 0 {
+			return exitStatus(code)
 		}
+	}
+	return nil
+}
+
+func newStatusReport(config *Config, loadedRC, foundRC *RC) *statusReport {
+	report := &statusReport{
+		Config: statusConfig{
+			SelfPath:        config.SelfPath,
+			ConfigDir:       config.ConfDir,
+			TomlPath:        config.TomlPath,
+			BashPath:        config.BashPath,
+			AsyncLoad:       config.AsyncLoad,
+			DisableStdin:    config.DisableStdin,
+			LogFile:         config.LogFile,
+			QuietLoad:       config.QuietLoad,
+			StrictEnv:       config.StrictEnv,
+			WarnTimeout:     config.WarnTimeout.String(),
+			WhitelistPrefix: config.WhitelistPrefix,
+			WhitelistExact:  make([]string, 0, len(config.WhitelistExact)),
+		},
+	}
+	for path := range config.WhitelistExact {
+		report.Config.WhitelistExact = append(report.Config.WhitelistExact, path)
+	}
+	sort.Strings(report.Config.WhitelistExact)
+
+	stale := false
+	if loadedRC != nil {
+		report.Loaded = newStatusRC(loadedRC)
+		for _, watch := range report.Loaded.Watches {
+			stale = stale || watch.Stale
+		}
+	}
+
+	if foundRC != nil {
+		report.Found = newStatusRC(foundRC)
+		status, reason := foundRC.AllowStatus()
+		report.Found.Allow = &statusAllow{status, reason, foundRC.allowPath}
+	}
+
+	switch {
+	case foundRC == nil:
+		report.State = statusNone
+	case report.Found.Allow.Status == allowStatusDenied:
+		report.State = statusDenied
+	case report.Found.Allow.Status == allowStatusBlocked:
+		report.State = statusBlocked
+	case loadedRC == nil || loadedRC.path != foundRC.path:
+		report.State = statusUnloaded
+	case stale:
+		report.State = statusStale
+	default:
+		report.State = statusLoaded
+	}
+
+	return report
+}
 
-		if foundRC != nil {
-			formatRC("Found", foundRC)
-		} else {
-			fmt.Println("No .envrc found")
+func newStatusRC(rc *RC) *statusRC {
+	s := &statusRC{Path: rc.path, Watches: make([]*statusWatch, 0, len(*rc.times.list))}
+	for _, t := range *rc.times.list {
+		watch := &statusWatch{
+			Path:    t.Path,
+			Kind:    t.Kind,
+			Modtime: t.Modtime,
+			Exists:  t.Exists,
 		}
+		if err := t.Check(); err != nil {
+			watch.Stale = true
+			watch.Reason = err.Error()
+		}
+		s.Watches = append(s.Watches, watch)
+	}
+	return s
+}
 
-		return nil
-	}),
+func printStatus(config *Config, loadedRC, foundRC *RC) {
+	fmt.Println("direnv exec path", config.SelfPath)
+	fmt.Println("DIRENV_CONFIG", config.ConfDir)
+
+	fmt.Println("bash_path", config.BashPath)
+	fmt.Println("disable_stdin", config.DisableStdin)
+	fmt.Println("warn_timeout", config.WarnTimeout)
+	fmt.Println("whitelist.prefix", config.WhitelistPrefix)
+	fmt.Println("whitelist.exact", config.WhitelistExact)
+
+	if loadedRC != nil {
+		formatRC("Loaded", loadedRC)
+	} else {
+		fmt.Println("No .envrc loaded")
+	}
+
+	if foundRC != nil {
+		formatRC("Found", foundRC)
+		status, reason := foundRC.AllowStatus()
+		fmt.Println("Found RC allow status", status, "("+reason+")")
+	} else {
+		fmt.Println("No .envrc found")
+	}
 }
 
 func formatRC(desc string, rc *RC) {
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -10,7 +14,47 @@ var CmdStdlib = &Cmd{
 	Name: "stdlib",
 	Desc: "Displays the stdlib available in the .envrc execution context",
 	Action: actionWithConfig(func(env Env, args []string, config *Config) error {
-		fmt.Println(strings.Replace(StdLib, "$(command -v direnv)", config.SelfPath, 1))
+		fmt.Println(stdlib(config))
 		return nil
 	}),
 }
+
+// stdlib returns the StdLib with the path to direnv filled in
+func stdlib(config *Config) string {
+	return strings.Replace(StdLib, "$(command -v direnv)", config.SelfPath, 1)
+}
+
+// stdlibPath returns the path to a copy of the stdlib in the cache dir,
+// writing it on first use. The name depends on the version and content so
+// that upgrading or moving direnv produces a new file.
+func stdlibPath(config *Config) (string, error) {
+	content := stdlib(config) + "\n"
+	sum := sha256.Sum256([]byte(content))
+	path := filepath.Join(config.CacheDir, fmt.Sprintf("stdlib-%s-%x.sh", Version, sum[:8]))
+
+	if fileExists(path) {
+		return path, nil
+	}
+
+	if err := os.MkdirAll(config.CacheDir, 0755); err != nil {
+		return "", err
+	}
+
+	// Write to a temporary file first so that concurrent loads never source
+	// a partially written stdlib.
+	tmp, err := ioutil.TempFile(config.CacheDir, "stdlib-*.sh.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+
+	return path, os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStdlibPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "direnv-stdlib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := &Config{
+		CacheDir: filepath.Join(dir, "cache"),
+		SelfPath: "/usr/bin/direnv",
+	}
+
+	path, err := stdlibPath(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(path) != config.CacheDir {
+		t.Errorf("expected %s to be in %s", path, config.CacheDir)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != stdlib(config)+"\n" {
+		t.Error("the cached stdlib doesn't match")
+	}
+
+	// The cached copy is re-used as is
+	if err = ioutil.WriteFile(path, []byte("cached"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	again, err := stdlibPath(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != path {
+		t.Errorf("expected %s, got %s", path, again)
+	}
+	if content, _ = ioutil.ReadFile(path); string(content) != "cached" {
+		t.Error("the cached stdlib should not be written again")
+	}
+
+	// Moving direnv changes the content, and so the name
+	config.SelfPath = "/opt/bin/direnv"
+	moved, err := stdlibPath(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved == path {
+		t.Error("expected a new file when the path to direnv changes")
+	}
+
+	entries, err := ioutil.ReadDir(config.CacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected only the two stdlibs in the cache dir, got %d entries", len(entries))
+	}
+}
@@ -3,14 +3,14 @@ package main
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"strconv"
 )
 
-// CmdWatchDir is `direnv watch-dir SHELL PATH`
+// CmdWatchDir is `direnv watch-dir SHELL [OPTIONS] DIR`
 var CmdWatchDir = &Cmd{
 	Name:    "watch-dir",
 	Desc:    "Recursively adds a directory to the list that direnv watches for changes",
-	Args:    []string{"SHELL", "DIR"},
+	Args:    []string{"SHELL", "[--exclude PATTERN]...", "[--max-depth N]", "[--no-gitignore]", "DIR"},
 	Private: true,
 	Action:  actionSimple(watchDirCommand),
 }
@@ -21,7 +21,6 @@ func watchDirCommand(env Env, args []string) (err error) {
 	}
 
 	shellName := args[1]
-	dir := args[2]
 
 	shell := DetectShell(shellName)
 
@@ -29,6 +28,34 @@ func watchDirCommand(env Env, args []string) (err error) {
 		return fmt.Errorf("unknown target shell '%s'", shellName)
 	}
 
+	var dir string
+	opts := &dirOptions{}
+	for i := 2; i < len(args); i++ {
+		switch arg := args[i]; arg {
+		case "--exclude", "--max-depth":
+			if i+1 >= len(args) {
+				return fmt.Errorf("%s requires a value", arg)
+			}
+			i++
+			if arg == "--exclude" {
+				opts.Exclude = append(opts.Exclude, args[i])
+			} else if opts.MaxDepth, err = strconv.Atoi(args[i]); err != nil || opts.MaxDepth < 0 {
+				return fmt.Errorf("invalid depth '%s'", args[i])
+			}
+		case "--no-gitignore":
+			opts.NoGitignore = true
+		default:
+			if dir != "" {
+				return fmt.Errorf("unexpected argument '%s'", arg)
+			}
+			dir = arg
+		}
+	}
+
+	if dir == "" {
+		return fmt.Errorf("a directory is required to add to the list of watches")
+	}
+
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		return fmt.Errorf("dir '%s' does not exist", dir)
 	}
@@ -42,12 +69,7 @@ func watchDirCommand(env Env, args []string) (err error) {
 		}
 	}
 
-	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		return watches.NewTime(path, info.ModTime().Unix(), true)
-	})
+	err = watches.Dir(dir, opts)
 	if err != nil {
 		return fmt.Errorf("failed to recursively watch dir '%s': %w", dir, err)
 	}
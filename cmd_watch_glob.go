@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// CmdWatchGlob is `direnv watch-glob SHELL PATTERN...`
+var CmdWatchGlob = &Cmd{
+	Name:    "watch-glob",
+	Desc:    "Adds a glob pattern to the list that direnv watches for new, removed or changed files",
+	Args:    []string{"SHELL", "PATTERN..."},
+	Private: true,
+	Action:  actionSimple(watchGlobCommand),
+}
+
+func watchGlobCommand(env Env, args []string) (err error) {
+	if len(args) < 3 {
+		return fmt.Errorf("a pattern is required to add to the list of watches")
+	}
+
+	shellName := args[1]
+
+	shell := DetectShell(shellName)
+
+	if shell == nil {
+		return fmt.Errorf("unknown target shell '%s'", shellName)
+	}
+
+	watches := NewFileTimes()
+	watchString, ok := env[DIRENV_WATCHES]
+	if ok {
+		err = watches.Unmarshal(watchString)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, pattern := range args[2:] {
+		err = watches.Glob(pattern)
+		if err != nil {
+			return
+		}
+	}
+
+	e := make(ShellExport)
+	e.Add(DIRENV_WATCHES, watches.Marshal())
+
+	os.Stdout.WriteString(shell.Export(e))
+
+	return
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// CmdWhy is `direnv why VAR [DIR]`
+var CmdWhy = &Cmd{
+	Name:   "why",
+	Desc:   "Loads the .envrc found in DIR and shows where VAR was set",
+	Args:   []string{"VAR", "[DIR]"},
+	Action: actionWithConfig(cmdWhyAction),
+}
+
+func cmdWhyAction(env Env, args []string, config *Config) (err error) {
+	if len(args) < 2 {
+		return fmt.Errorf("missing VAR argument")
+	}
+	if len(args) > 3 {
+		return fmt.Errorf("unexpected argument '%s'", args[3])
+	}
+	key := args[1]
+	dir := config.WorkDir
+	if len(args) > 2 {
+		dir = args[2]
+	}
+
+	rcPath := findUp(dir, ".envrc")
+	if rcPath == "" {
+		return fmt.Errorf(".envrc file not found")
+	}
+	rc, err := RCFromPath(rcPath, config)
+	if err != nil {
+		return
+	}
+
+	previousEnv, err := config.Revert(env)
+	if err != nil {
+		return
+	}
+
+	// The .envrc is evaluated again to trace it, which can give another
+	// result than the load in effect, so the latter is kept for comparison.
+	var loaded Env
+	if env[DIRENV_DIR] == "-"+filepath.Dir(rcPath) {
+		if diff, err := LoadEnvDiff(env[DIRENV_DIFF]); err == nil {
+			loaded = diff.Patch(previousEnv)
+		}
+	}
+	previousEnv.CleanContext()
+
+	trace, err := ioutil.TempFile("", "direnv-why")
+	if err != nil {
+		return
+	}
+	trace.Close()
+	defer os.Remove(trace.Name())
+
+	newEnv, err := rc.load(previousEnv, trace.Name())
+	if err != nil && !isEvalError(err) {
+		return
+	}
+
+	traceFile, err := os.Open(trace.Name())
+	if err != nil {
+		return
+	}
+	defer traceFile.Close()
+
+	lines, err := readTrace(traceFile)
+	if err != nil {
+		return
+	}
+
+	changes := traceAssignments(lines, key)
+	if len(changes) == 0 {
+		return fmt.Errorf("%s isn't set by %s", key, rcPath)
+	}
+
+	printWhy(os.Stdout, key, newEnv, loaded, changes, config.Secrets(newEnv))
+	return nil
+}
+
+// printWhy shows the changes to key. loaded is the env of the load in
+// effect, if any, to warn when evaluating the .envrc again gave another value.
+func printWhy(w io.Writer, key string, newEnv, loaded Env, changes []traceLine, secrets *secretPolicy) {
+	describe := func(env Env) string {
+		if value, ok := env[key]; ok {
+			return fmt.Sprintf("%s=%s", key, secrets.Redact(key, value))
+		}
+		return fmt.Sprintf("%s is unset", key)
+	}
+
+	fmt.Fprintln(w, describe(newEnv))
+	if loaded != nil {
+		value, ok := loaded[key]
+		if newValue, newOk := newEnv[key]; ok != newOk || value != newValue {
+			fmt.Fprintf(w, "\nwarning: the .envrc gave another result than the load in effect, where %s.\n", describe(loaded))
+			fmt.Fprintln(w, "It may depend on the time or on the environment. Run `direnv reload` to apply the new result.")
+		}
+	}
+	if len(changes) > 1 {
+		fmt.Fprintf(w, "\nit was changed %d times, the last one wins:\n", len(changes))
+	}
+
+	for _, l := range changes {
+		fmt.Fprintln(w)
+		for i, frame := range loadedFrames(l) {
+			location := fmt.Sprintf("%s:%d", userRelPath(newEnv, frame.source), frame.line)
+			if frame.funcName != "" && frame.funcName != "source" {
+				location += " in " + frame.funcName
+			}
+			if i == 0 {
+				fmt.Fprintf(w, "  %s\n", location)
+				if !secrets.IsSecret(key) {
+					fmt.Fprintf(w, "    %s\n", l.command)
+				}
+			} else {
+				fmt.Fprintf(w, "    called from %s\n", location)
+			}
+		}
+	}
+}
+
+// loadedFrames returns the frames of the call stack that belong to the
+// loaded files, leaving out __main__ and the root source_env.
+func loadedFrames(l traceLine) []traceFrame {
+	frames := l.frames
+	for i, frame := range frames {
+		if frame.funcName == "__main__" ||
+			(frame.funcName == "source_env" && i+1 < len(frames) && frames[i+1].funcName == "__main__") {
+			return frames[:i]
+		}
+	}
+	return frames
+}
+
+var traceAssignRe = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\+?=`)
+
+// traceAssignments returns the traced commands that set or unset key in the
+// scope of the .envrc.
+func traceAssignments(lines []traceLine, key string) (changes []traceLine) {
+	for i := 0; i < len(lines); {
+		// Group the lines that trace the same simple command
+		j := i + 1
+		for j < len(lines) && sameTracedCommand(lines[i], lines[j]) {
+			j++
+		}
+		if l, ok := commandAssigns(lines[i:j], key); ok {
+			changes = append(changes, l)
+		}
+		i = j
+	}
+	return
+}
+
+func sameTracedCommand(a, b traceLine) bool {
+	return a.bashCommand == b.bashCommand &&
+		a.subshell == b.subshell &&
+		a.frames[0] == b.frames[0]
+}
+
+// commandAssigns returns the line of the simple command that changes key
+func commandAssigns(group []traceLine, key string) (traceLine, bool) {
+	// Changes made in subshells are lost
+	if group[0].subshell > 0 {
+		return traceLine{}, false
+	}
+
+	for _, l := range group {
+		words := splitTraceWords(l.command)
+		if len(words) == 0 || traceAssignRe.MatchString(words[0]) {
+			continue
+		}
+		// The assignments of the group are either done by a declaration
+		// builtin, or only apply to the command that they prefix.
+		return l, builtinAssigns(words, key)
+	}
+
+	for _, l := range group {
+		if m := traceAssignRe.FindStringSubmatch(l.command); m != nil && m[1] == key {
+			return l, true
+		}
+	}
+	return traceLine{}, false
+}
+
+// builtinAssigns returns true if the words of the command are a builtin that
+// sets or unsets key in the scope of the .envrc.
+func builtinAssigns(words []string, key string) bool {
+	assigns := func(words []string) bool {
+		for _, word := range words {
+			if m := traceAssignRe.FindStringSubmatch(word); m != nil && m[1] == key {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch words[0] {
+	case "export", "readonly":
+		return assigns(words[1:])
+	case "declare", "typeset":
+		// Without -g, they only declare locals as the files are loaded
+		// from a function
+		for _, word := range words[1:] {
+			if strings.HasPrefix(word, "-") && strings.Contains(word, "g") {
+				return assigns(words[1:])
+			}
+		}
+	case "unset":
+		for _, word := range words[1:] {
+			if word == "-f" {
+				return false
+			}
+			if word == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitTraceWords splits a command as quoted by the bash xtrace into words.
+// The quotes are kept.
+func splitTraceWords(command string) (words []string) {
+	var (
+		word   strings.Builder
+		inWord bool
+	)
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+			continue
+		case c == '\\' && i+1 < len(command):
+			word.WriteByte(c)
+			i++
+			c = command[i]
+		case c == '\'':
+			// Inside of $'...' the quotes can be escaped
+			ansi := i > 0 && command[i-1] == '$'
+			word.WriteByte(c)
+			for i++; i < len(command) && command[i] != '\''; i++ {
+				if ansi && command[i] == '\\' && i+1 < len(command) {
+					word.WriteByte(command[i])
+					i++
+				}
+				word.WriteByte(command[i])
+			}
+			if i >= len(command) {
+				inWord = true
+				continue
+			}
+		}
+		word.WriteByte(c)
+		inWord = true
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitTraceWords(t *testing.T) {
+	words := splitTraceWords(`export 'A=a b' B=$'c\'d' C=e\ f`)
+	expected := []string{"export", "'A=a b'", `B=$'c\'d'`, `C=e\ f`}
+	if !reflect.DeepEqual(words, expected) {
+		t.Errorf("expected %q, got %q", expected, words)
+	}
+}
+
+func TestTraceAssignments(t *testing.T) {
+	line := func(n int, subshell int, bashCommand, command string) traceLine {
+		return traceLine{
+			frames:      []traceFrame{{source: "/p/.envrc", line: n}},
+			subshell:    subshell,
+			bashCommand: bashCommand,
+			command:     command,
+		}
+	}
+	lines := []traceLine{
+		line(1, 0, "export FOO=1", "export FOO=1"),
+		line(1, 0, "export FOO=1", "FOO=1"),
+		line(2, 0, "FOO=2 true", "FOO=2"),
+		line(2, 0, "FOO=2 true", "true"),
+		line(3, 1, "FOO=3", "FOO=3"),
+		line(4, 0, "local FOO=4", "local FOO=4"),
+		line(5, 0, "BAR=5 FOO=5", "BAR=5"),
+		line(5, 0, "BAR=5 FOO=5", "FOO=5"),
+		line(6, 0, "unset FOO", "unset FOO"),
+	}
+
+	var found []int
+	for _, l := range traceAssignments(lines, "FOO") {
+		found = append(found, l.frames[0].line)
+	}
+	if expected := []int{1, 5, 6}; !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected the assignments on lines %v, got %v", expected, found)
+	}
+}
+
+func TestPrintWhyLoadedMismatch(t *testing.T) {
+	changes := []traceLine{{
+		frames:  []traceFrame{{source: "/p/.envrc", line: 1}},
+		command: "export FOO=2",
+	}}
+	secrets := newSecretPolicy(nil, Env{})
+
+	cases := []struct {
+		desc   string
+		loaded Env
+		warn   string
+	}{
+		{"nothing loaded", nil, ""},
+		{"same value", Env{"FOO": "2"}, ""},
+		{"other value", Env{"FOO": "1"}, "where FOO=1."},
+		{"unset", Env{}, "where FOO is unset."},
+	}
+
+	for _, c := range cases {
+		var out strings.Builder
+		printWhy(&out, "FOO", Env{"FOO": "2"}, c.loaded, changes, secrets)
+		warned := strings.Contains(out.String(), "warning:")
+		if warned != (c.warn != "") || !strings.Contains(out.String(), c.warn) {
+			t.Errorf("%s: unexpected output %q", c.desc, out.String())
+		}
+	}
+}
@@ -26,6 +26,14 @@ func (fn actionWithConfig) Call(env Env, args []string, config *Config) error {
 	return fn(env, args, config)
 }
 
+// exitStatus is returned by the commands that report their result with the
+// exit status of direnv, rather than with an error message
+type exitStatus int
+
+func (status exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(status))
+}
+
 type action interface {
 	Call(env Env, args []string, config *Config) error
 }
@@ -47,16 +55,22 @@ func init() {
 	CmdList = []*Cmd{
 		CmdAllow,
 		CmdApplyDump,
+		CmdAsyncLoad,
 		CmdShowDump,
+		CmdDaemon,
 		CmdDeny,
+		CmdDiff,
+		CmdDoctor,
 		CmdDotEnv,
 		CmdDump,
 		CmdEdit,
 		CmdExec,
+		CmdExpireAfter,
 		CmdExport,
 		CmdFetchURL,
 		CmdHelp,
 		CmdHook,
+		CmdProfile,
 		CmdPrune,
 		CmdReload,
 		CmdStatus,
@@ -64,7 +78,9 @@ func init() {
 		CmdVersion,
 		CmdWatch,
 		CmdWatchDir,
+		CmdWatchGlob,
 		CmdWatchList,
+		CmdWhy,
 		CmdCurrent,
 	}
 }
@@ -77,7 +93,7 @@ func cmdWithWarnTimeout(fn action) action {
 			case <-done:
 				return
 			case <-time.After(config.WarnTimeout):
-				logError("(%v) is taking a while to execute. Use CTRL-C to give up.", args)
+				logWarn("(%v) is taking a while to execute. Use CTRL-C to give up.", args)
 			}
 		}()
 
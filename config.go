@@ -22,8 +22,14 @@ type Config struct {
 	SelfPath        string
 	BashPath        string
 	RCDir           string
+	PathLists       []string
+	SecretPatterns  []string
 	TomlPath        string
+	AsyncLoad       bool
 	DisableStdin    bool
+	LogFile         string
+	QuietLoad       bool
+	QuietLoadLines  int
 	StrictEnv       bool
 	WarnTimeout     time.Duration
 	WhitelistPrefix []string
@@ -43,14 +49,24 @@ func (d *tomlDuration) UnmarshalText(text []byte) error {
 type tomlConfig struct {
 	*tomlGlobal               // For backward-compatibility
 	Global      *tomlGlobal   `toml:"global"`
+	Secrets     tomlSecrets   `toml:"secrets"`
 	Whitelist   tomlWhitelist `toml:"whitelist"`
 }
 
 type tomlGlobal struct {
-	BashPath     string       `toml:"bash_path"`
-	DisableStdin bool         `toml:"disable_stdin"`
-	StrictEnv    bool         `toml:"strict_env"`
-	WarnTimeout  tomlDuration `toml:"warn_timeout"`
+	AsyncLoad      bool         `toml:"async_load"`
+	BashPath       string       `toml:"bash_path"`
+	DisableStdin   bool         `toml:"disable_stdin"`
+	LogFile        string       `toml:"log_file"`
+	PathLists      []string     `toml:"path_lists"`
+	QuietLoad      bool         `toml:"quiet_load"`
+	QuietLoadLines int          `toml:"quiet_load_lines"`
+	StrictEnv      bool         `toml:"strict_env"`
+	WarnTimeout    tomlDuration `toml:"warn_timeout"`
+}
+
+type tomlSecrets struct {
+	Patterns []string
 }
 
 type tomlWhitelist struct {
@@ -128,8 +144,15 @@ func LoadConfig(env Env) (config *Config, err error) {
 			config.WhitelistExact[path] = true
 		}
 
+		config.SecretPatterns = tomlConf.Secrets.Patterns
+
+		config.AsyncLoad = tomlConf.AsyncLoad
 		config.BashPath = tomlConf.BashPath
 		config.DisableStdin = tomlConf.DisableStdin
+		config.LogFile = tomlConf.LogFile
+		config.PathLists = tomlConf.PathLists
+		config.QuietLoad = tomlConf.QuietLoad
+		config.QuietLoadLines = tomlConf.QuietLoadLines
 		config.StrictEnv = tomlConf.StrictEnv
 		config.WarnTimeout = tomlConf.WarnTimeout.Duration
 	}
@@ -137,12 +160,28 @@ func LoadConfig(env Env) (config *Config, err error) {
 	if config.WarnTimeout == 0 {
 		timeout, err := time.ParseDuration(env.Fetch("DIRENV_WARN_TIMEOUT", "5s"))
 		if err != nil {
-			logError("invalid DIRENV_WARN_TIMEOUT: " + err.Error())
+			logWarn("invalid DIRENV_WARN_TIMEOUT: " + err.Error())
 			timeout = 5 * time.Second
 		}
 		config.WarnTimeout = timeout
 	}
 
+	if config.SecretPatterns == nil {
+		config.SecretPatterns = defaultSecretPatterns
+	}
+
+	if config.PathLists == nil {
+		config.PathLists = defaultPathLists
+	}
+
+	if strings.HasPrefix(config.LogFile, "~/") {
+		config.LogFile = filepath.Join(env["HOME"], config.LogFile[2:])
+	}
+
+	if config.QuietLoadLines <= 0 {
+		config.QuietLoadLines = 20
+	}
+
 	if config.BashPath == "" {
 		if env[DIRENV_BASH] != "" {
 			config.BashPath = env[DIRENV_BASH]
@@ -178,6 +217,16 @@ func (config *Config) AllowDir() string {
 	return filepath.Join(config.DataDir, "allow")
 }
 
+// DenyDir is the folder where the files of the denied .envrc are recorded.
+func (config *Config) DenyDir() string {
+	return filepath.Join(config.DataDir, "deny")
+}
+
+// JobsDir is the folder where the background loads are tracked.
+func (config *Config) JobsDir() string {
+	return filepath.Join(config.CacheDir, "jobs")
+}
+
 // LoadedRC returns a RC file if any has been loaded
 func (config *Config) LoadedRC() *RC {
 	if config.RCDir == "" {
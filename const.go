@@ -9,6 +9,7 @@ const (
 	DIRENV_DIR     = "DIRENV_DIR"
 	DIRENV_WATCHES = "DIRENV_WATCHES"
 	DIRENV_DIFF    = "DIRENV_DIFF"
+	DIRENV_SECRETS = "DIRENV_SECRETS"
 
 	DIRENV_DUMP_FILE_PATH = "DIRENV_DUMP_FILE_PATH"
 )
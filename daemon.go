@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/direnv/direnv/v2/xdg"
+)
+
+// CmdDaemon is `direnv daemon`
+var CmdDaemon = &Cmd{
+	Name:   "daemon",
+	Desc:   "Runs a background process that tracks the watched files so that the prompt hook doesn't have to",
+	Action: actionSimple(cmdDaemonAction),
+}
+
+func cmdDaemonAction(env Env, args []string) error {
+	socketPath := daemonSocketPath(env)
+	if socketPath == "" {
+		return fmt.Errorf("couldn't find a cache directory for direnv")
+	}
+	return runDaemon(socketPath)
+}
+
+// The daemon protocol is line based. The client sends a request made of a
+// verb and the marshalled DIRENV_WATCHES, and the daemon replies with one of
+// the answers below.
+const (
+	daemonCheck   = "CHECK"
+	daemonFresh   = "FRESH"
+	daemonStale   = "STALE"
+	daemonUnknown = "UNKNOWN"
+)
+
+// daemonTimeout bounds how long the prompt can be delayed by a daemon that
+// doesn't respond.
+const daemonTimeout = 100 * time.Millisecond
+
+// daemonSocketPath returns where the daemon listens. It only depends on the
+// env so that it can be computed without loading the config.
+func daemonSocketPath(env Env) string {
+	cacheDir := xdg.CacheDir(env, "direnv")
+	if cacheDir == "" {
+		return ""
+	}
+	return filepath.Join(cacheDir, "daemon.sock")
+}
+
+// daemonCheckWatches asks the daemon whether the watches are still fresh. ok
+// is false if the daemon isn't running or doesn't know the answer, in which
+// case the caller has to stat the watches itself.
+func daemonCheckWatches(env Env, watches string) (fresh bool, ok bool) {
+	socketPath := daemonSocketPath(env)
+	if socketPath == "" || watches == "" {
+		return
+	}
+
+	conn, err := net.DialTimeout("unix", socketPath, daemonTimeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(daemonTimeout)); err != nil {
+		return
+	}
+
+	if _, err = conn.Write([]byte(daemonCheck + " " + watches + "\n")); err != nil {
+		logDebug("daemon: write failed: %v", err)
+		return
+	}
+
+	answer, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		logDebug("daemon: read failed: %v", err)
+		return
+	}
+
+	switch strings.TrimSpace(answer) {
+	case daemonFresh:
+		return true, true
+	case daemonStale:
+		return false, true
+	}
+	return
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// daemonMask covers everything that can change the stat of a file
+	// inside of a watched directory, or make it appear or disappear.
+	daemonMask = unix.IN_ATTRIB | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+		unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+		unix.IN_DELETE_SELF | unix.IN_MOVE_SELF | unix.IN_ONLYDIR
+
+	// Sessions that haven't been queried for that long are forgotten
+	daemonSessionTTL = time.Hour
+)
+
+// daemon keeps one session per DIRENV_WATCHES value that has been asked about,
+// and an inotify watch on each directory that contains a watched file.
+type daemon struct {
+	fd int
+	// broken is set when the inotify events can't be read anymore
+	broken   bool
+	mu       sync.Mutex
+	sessions map[string]*daemonSession
+	dirs     map[string]*daemonDir
+	wds      map[int32]*daemonDir
+}
+
+type daemonDir struct {
+	wd       int32
+	path     string
+	sessions map[*daemonSession]bool
+}
+
+type daemonSession struct {
+	times    FileTimes
+	names    map[string]map[string]bool // dir -> watched file names
+	globs    map[string][]string        // dir -> watched name patterns
+	deadline int64
+	// unsupported sessions contain watches that the daemon can't track,
+	// like directory watches or symlinks.
+	unsupported bool
+	stale       bool
+	lastSeen    time.Time
+}
+
+func runDaemon(socketPath string) (err error) {
+	if err = os.MkdirAll(filepath.Dir(socketPath), 0700); err != nil {
+		return
+	}
+
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return fmt.Errorf("a daemon is already listening on %s", socketPath)
+	}
+	_ = os.Remove(socketPath)
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify_init1: %w", err)
+	}
+	defer unix.Close(fd)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return
+	}
+	defer os.Remove(socketPath)
+	defer listener.Close()
+
+	d := &daemon{
+		fd:       fd,
+		sessions: make(map[string]*daemonSession),
+		dirs:     make(map[string]*daemonDir),
+		wds:      make(map[int32]*daemonDir),
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		listener.Close()
+	}()
+
+	go d.readEvents()
+	go d.collect()
+
+	logStatus(Env{}, "daemon listening on %s", socketPath)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// The listener has been closed by the signal handler
+			return nil
+		}
+		go d.serve(conn)
+	}
+}
+
+func (d *daemon) serve(conn net.Conn) {
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(time.Second)); err != nil {
+		return
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	answer := daemonUnknown
+	if elems := strings.SplitN(strings.TrimSpace(line), " ", 2); len(elems) == 2 && elems[0] == daemonCheck {
+		answer = d.check(elems[1])
+	}
+
+	_, _ = conn.Write([]byte(answer + "\n"))
+}
+
+func (d *daemon) check(watches string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.drain()
+
+	s, ok := d.sessions[watches]
+	if !ok {
+		s = d.register(watches)
+		d.sessions[watches] = s
+	}
+	s.lastSeen = time.Now()
+
+	switch {
+	case d.broken || s.unsupported:
+		return daemonUnknown
+	case s.stale:
+		// The reload may record the same watches, for example after a
+		// chmod or a write within the same second, so the next check
+		// registers them again and compares the files once more.
+		d.forget(s)
+		delete(d.sessions, watches)
+		return daemonStale
+	case s.deadline != 0 && time.Now().Unix() >= s.deadline:
+		return daemonStale
+	}
+	return daemonFresh
+}
+
+// register starts tracking the watches. It must be called with the lock held.
+func (d *daemon) register(watches string) *daemonSession {
+	s := &daemonSession{
+		times: NewFileTimes(),
+		names: make(map[string]map[string]bool),
+		globs: make(map[string][]string),
+	}
+
+	if err := s.times.Unmarshal(watches); err != nil {
+		s.unsupported = true
+		return s
+	}
+
+	for _, watch := range *s.times.list {
+		dir, name := filepath.Split(watch.Path)
+		dir = filepath.Clean(dir)
+
+		switch watch.Kind {
+		case "":
+			if stat, err := os.Lstat(watch.Path); err == nil && stat.Mode()&os.ModeSymlink != 0 {
+				s.unsupported = true
+			}
+			if s.names[dir] == nil {
+				s.names[dir] = make(map[string]bool)
+			}
+			s.names[dir][name] = true
+		case globKind:
+			if strings.ContainsAny(dir, `*?[\`) {
+				s.unsupported = true
+			}
+			s.globs[dir] = append(s.globs[dir], name)
+		case expireKind:
+			s.deadline = watch.Modtime
+		default:
+			s.unsupported = true
+		}
+	}
+	if s.unsupported {
+		return s
+	}
+
+	for dir := range s.names {
+		if !d.watch(dir, s) {
+			s.unsupported = true
+		}
+	}
+	for dir := range s.globs {
+		if !d.watch(dir, s) {
+			s.unsupported = true
+		}
+	}
+	if s.unsupported {
+		d.forget(s)
+		return s
+	}
+
+	// Changes that happened before the inotify watches were in place would
+	// go unnoticed, so compare against the recorded state once.
+	if err := s.times.Check(); err != nil {
+		logDebug("daemon: stale on registration: %v", err)
+		s.stale = true
+	}
+
+	return s
+}
+
+func (d *daemon) watch(dir string, s *daemonSession) bool {
+	wdir, ok := d.dirs[dir]
+	if !ok {
+		wd, err := unix.InotifyAddWatch(d.fd, dir, daemonMask)
+		if err != nil {
+			logDebug("daemon: inotify_add_watch %s: %v", dir, err)
+			return false
+		}
+		if wdir, ok = d.wds[int32(wd)]; !ok {
+			wdir = &daemonDir{
+				wd:       int32(wd),
+				path:     dir,
+				sessions: make(map[*daemonSession]bool),
+			}
+			d.wds[wdir.wd] = wdir
+		}
+		d.dirs[dir] = wdir
+	}
+	wdir.sessions[s] = true
+	return true
+}
+
+// forget stops tracking the session. It must be called with the lock held.
+func (d *daemon) forget(s *daemonSession) {
+	for _, wdir := range d.wds {
+		delete(wdir.sessions, s)
+		if len(wdir.sessions) == 0 {
+			_, _ = unix.InotifyRmWatch(d.fd, uint32(wdir.wd))
+			d.drop(wdir)
+		}
+	}
+}
+
+func (d *daemon) drop(wdir *daemonDir) {
+	delete(d.wds, wdir.wd)
+	for dir, other := range d.dirs {
+		if other == wdir {
+			delete(d.dirs, dir)
+		}
+	}
+}
+
+func (d *daemon) readEvents() {
+	fds := []unix.PollFd{{Fd: int32(d.fd), Events: unix.POLLIN}}
+	for {
+		_, err := unix.Poll(fds, -1)
+		if err == unix.EINTR {
+			continue
+		}
+
+		d.mu.Lock()
+		if err != nil || fds[0].Revents&(unix.POLLERR|unix.POLLNVAL) != 0 {
+			logDebug("daemon: polling inotify events failed: %v", err)
+			d.broken = true
+		} else {
+			d.drain()
+		}
+		broken := d.broken
+		d.mu.Unlock()
+
+		if broken {
+			return
+		}
+	}
+}
+
+// drain processes the queued events. It's also called before answering a
+// client, as the kernel queues the event before returning from the syscall
+// that caused it, so that a file saved right before the prompt is never
+// reported as fresh. It must be called with the lock held.
+func (d *daemon) drain() {
+	var buf [(unix.SizeofInotifyEvent + unix.NAME_MAX + 1) * 64]byte
+	for {
+		n, err := unix.Read(d.fd, buf[:])
+		switch {
+		case err == unix.EINTR:
+			continue
+		case err == unix.EAGAIN:
+			return
+		case err != nil || n <= 0:
+			logDebug("daemon: reading inotify events failed: %v", err)
+			d.broken = true
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(event.Len)]
+			name := string(bytes.TrimRight(nameBytes, "\x00"))
+			d.handle(event, name)
+			offset += unix.SizeofInotifyEvent + int(event.Len)
+		}
+	}
+}
+
+// handle processes a single event. It must be called with the lock held.
+func (d *daemon) handle(event *unix.InotifyEvent, name string) {
+	if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+		// Events were lost. Forget everything so that clients go back to
+		// checking the files themselves until they register again.
+		logDebug("daemon: event queue overflow")
+		for _, s := range d.sessions {
+			d.forget(s)
+		}
+		d.sessions = make(map[string]*daemonSession)
+		return
+	}
+
+	wdir, ok := d.wds[event.Wd]
+	if !ok {
+		return
+	}
+
+	if event.Mask&(unix.IN_IGNORED|unix.IN_DELETE_SELF|unix.IN_MOVE_SELF) != 0 {
+		for s := range wdir.sessions {
+			s.stale = true
+		}
+		if event.Mask&unix.IN_IGNORED != 0 {
+			d.drop(wdir)
+		}
+		return
+	}
+
+	for s := range wdir.sessions {
+		if s.matches(wdir.path, name) {
+			logDebug("daemon: %s changed", filepath.Join(wdir.path, name))
+			s.stale = true
+		}
+	}
+}
+
+func (s *daemonSession) matches(dir, name string) bool {
+	if s.names[dir][name] {
+		return true
+	}
+	for _, pattern := range s.globs[dir] {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// collect periodically forgets the sessions that are no longer in use.
+func (d *daemon) collect() {
+	for range time.Tick(daemonSessionTTL / 4) {
+		d.mu.Lock()
+		for watches, s := range d.sessions {
+			if time.Since(s.lastSeen) > daemonSessionTTL {
+				d.forget(s)
+				delete(d.sessions, watches)
+			}
+		}
+		d.mu.Unlock()
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func newTestDaemon(t *testing.T) *daemon {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { unix.Close(fd) })
+
+	return &daemon{
+		fd:       fd,
+		sessions: make(map[string]*daemonSession),
+		dirs:     make(map[string]*daemonDir),
+		wds:      make(map[int32]*daemonDir),
+	}
+}
+
+func daemonTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "direnv-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	// The paths are compared with the ones reported by the kernel
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeDaemonFile(t *testing.T, path string) {
+	if err := ioutil.WriteFile(path, []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDaemonRegisterUnsupported(t *testing.T) {
+	dir := daemonTestDir(t)
+	writeDaemonFile(t, filepath.Join(dir, "target"))
+	if err := os.Symlink(filepath.Join(dir, "target"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub1"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		desc  string
+		watch func(times *FileTimes) error
+	}{
+		{"symlink", func(times *FileTimes) error {
+			return times.Update(filepath.Join(dir, "link"))
+		}},
+		{"directory", func(times *FileTimes) error {
+			return times.Dir(filepath.Join(dir, "sub1"), nil)
+		}},
+		{"glob directory", func(times *FileTimes) error {
+			return times.Glob(filepath.Join(dir, "sub*", "*.yml"))
+		}},
+	}
+
+	for _, c := range cases {
+		d := newTestDaemon(t)
+		times := NewFileTimes()
+		if err := times.Update(filepath.Join(dir, "target")); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.watch(&times); err != nil {
+			t.Fatalf("%s: %v", c.desc, err)
+		}
+
+		if answer := d.check(times.Marshal()); answer != daemonUnknown {
+			t.Errorf("%s: expected %s, got %s", c.desc, daemonUnknown, answer)
+		}
+		if len(d.wds) != 0 || len(d.dirs) != 0 {
+			t.Errorf("%s: the directories of unsupported sessions should not be watched", c.desc)
+		}
+	}
+
+	d := newTestDaemon(t)
+	if answer := d.check("not marshalled watches"); answer != daemonUnknown {
+		t.Errorf("invalid watches: expected %s, got %s", daemonUnknown, answer)
+	}
+}
+
+func TestDaemonSessionMatches(t *testing.T) {
+	s := &daemonSession{
+		names: map[string]map[string]bool{"/a": {".envrc": true}},
+		globs: map[string][]string{"/b": {"*.yml"}},
+	}
+
+	cases := []struct {
+		dir, name string
+		expect    bool
+	}{
+		{"/a", ".envrc", true},
+		{"/a", ".env", false},
+		{"/b", ".envrc", false},
+		{"/b", "config.yml", true},
+		{"/b", "config.yaml", false},
+		{"/a", "config.yml", false},
+		{"/c", ".envrc", false},
+	}
+
+	for _, c := range cases {
+		if got := s.matches(c.dir, c.name); got != c.expect {
+			t.Errorf("matches(%q, %q) = %v, expected %v", c.dir, c.name, got, c.expect)
+		}
+	}
+}
+
+func TestDaemonCheck(t *testing.T) {
+	dir := daemonTestDir(t)
+	envrc := filepath.Join(dir, ".envrc")
+	writeDaemonFile(t, envrc)
+
+	times := NewFileTimes()
+	if err := times.Update(envrc); err != nil {
+		t.Fatal(err)
+	}
+	if err := times.Glob(filepath.Join(dir, "*.yml")); err != nil {
+		t.Fatal(err)
+	}
+	watches := times.Marshal()
+
+	d := newTestDaemon(t)
+	if answer := d.check(watches); answer != daemonFresh {
+		t.Fatalf("expected %s, got %s", daemonFresh, answer)
+	}
+
+	writeDaemonFile(t, filepath.Join(dir, "unrelated.txt"))
+	if answer := d.check(watches); answer != daemonFresh {
+		t.Errorf("unrelated file: expected %s, got %s", daemonFresh, answer)
+	}
+
+	writeDaemonFile(t, filepath.Join(dir, "new.yml"))
+	if answer := d.check(watches); answer != daemonStale {
+		t.Errorf("glob match: expected %s, got %s", daemonStale, answer)
+	}
+
+	d = newTestDaemon(t)
+	if answer := d.check(watches); answer != daemonStale {
+		t.Errorf("changed before registration: expected %s, got %s", daemonStale, answer)
+	}
+}
+
+func TestDaemonCheckAfterChmod(t *testing.T) {
+	dir := daemonTestDir(t)
+	envrc := filepath.Join(dir, ".envrc")
+	writeDaemonFile(t, envrc)
+
+	times := NewFileTimes()
+	if err := times.Update(envrc); err != nil {
+		t.Fatal(err)
+	}
+	watches := times.Marshal()
+
+	d := newTestDaemon(t)
+	if answer := d.check(watches); answer != daemonFresh {
+		t.Fatalf("expected %s, got %s", daemonFresh, answer)
+	}
+
+	// IN_ATTRIB, without changing the modification time
+	if err := os.Chmod(envrc, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if answer := d.check(watches); answer != daemonStale {
+		t.Errorf("chmod: expected %s, got %s", daemonStale, answer)
+	}
+
+	// The reload records the same watches, which are fresh again
+	if err := times.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if answer := d.check(watches); answer != daemonFresh {
+		t.Errorf("after the reload: expected %s, got %s", daemonFresh, answer)
+	}
+	if answer := d.check(watches); answer != daemonFresh {
+		t.Errorf("after the reload: expected %s, got %s", daemonFresh, answer)
+	}
+}
+
+func TestDaemonCheckDeadline(t *testing.T) {
+	dir := daemonTestDir(t)
+	envrc := filepath.Join(dir, ".envrc")
+	writeDaemonFile(t, envrc)
+
+	for _, c := range []struct {
+		deadline time.Time
+		expect   string
+	}{
+		{time.Now().Add(time.Hour), daemonFresh},
+		{time.Now().Add(-time.Second), daemonStale},
+	} {
+		times := NewFileTimes()
+		if err := times.Update(envrc); err != nil {
+			t.Fatal(err)
+		}
+		times.Expire(c.deadline)
+
+		d := newTestDaemon(t)
+		if answer := d.check(times.Marshal()); answer != c.expect {
+			t.Errorf("deadline %v: expected %s, got %s", c.deadline, c.expect, answer)
+		}
+	}
+}
+
+func TestDaemonHandle(t *testing.T) {
+	dir := daemonTestDir(t)
+	envrc := filepath.Join(dir, ".envrc")
+	writeDaemonFile(t, envrc)
+
+	times := NewFileTimes()
+	if err := times.Update(envrc); err != nil {
+		t.Fatal(err)
+	}
+	watches := times.Marshal()
+
+	register := func() (*daemon, *daemonSession, *daemonDir) {
+		d := newTestDaemon(t)
+		if answer := d.check(watches); answer != daemonFresh {
+			t.Fatalf("expected %s, got %s", daemonFresh, answer)
+		}
+		return d, d.sessions[watches], d.dirs[dir]
+	}
+
+	// Events were lost
+	d, s, _ := register()
+	d.handle(&unix.InotifyEvent{Wd: -1, Mask: unix.IN_Q_OVERFLOW}, "")
+	if len(d.sessions) != 0 || len(d.wds) != 0 || len(d.dirs) != 0 {
+		t.Error("IN_Q_OVERFLOW should forget all the sessions")
+	}
+	if s.stale {
+		t.Error("IN_Q_OVERFLOW should make the clients register again, not mark them stale")
+	}
+
+	// The watch was removed by the kernel
+	d, s, wdir := register()
+	d.handle(&unix.InotifyEvent{Wd: wdir.wd, Mask: unix.IN_IGNORED}, "")
+	if !s.stale {
+		t.Error("IN_IGNORED should mark the sessions stale")
+	}
+	if len(d.wds) != 0 || len(d.dirs) != 0 {
+		t.Error("IN_IGNORED should drop the watch")
+	}
+
+	// The directory was removed, IN_IGNORED follows
+	d, s, wdir = register()
+	d.handle(&unix.InotifyEvent{Wd: wdir.wd, Mask: unix.IN_DELETE_SELF}, "")
+	if !s.stale {
+		t.Error("IN_DELETE_SELF should mark the sessions stale")
+	}
+	if d.wds[wdir.wd] != wdir {
+		t.Error("IN_DELETE_SELF should keep the watch until IN_IGNORED")
+	}
+
+	// Events of other files in the directory
+	d, s, wdir = register()
+	d.handle(&unix.InotifyEvent{Wd: wdir.wd, Mask: unix.IN_MODIFY}, "other")
+	if s.stale {
+		t.Error("a change to an unwatched file should not mark the session stale")
+	}
+	d.handle(&unix.InotifyEvent{Wd: wdir.wd, Mask: unix.IN_MODIFY}, ".envrc")
+	if !s.stale {
+		t.Error("a change to a watched file should mark the session stale")
+	}
+}
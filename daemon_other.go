@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func runDaemon(socketPath string) error {
+	return fmt.Errorf("the daemon is not supported on %s", runtime.GOOS)
+}
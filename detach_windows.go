@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess makes the command survive the console it was started from
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+// processAlive can't cheaply tell if a process exists on Windows, so the
+// job is assumed to be running until it records its result.
+func processAlive(pid int) bool {
+	return true
+}
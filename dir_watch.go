@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// dirOptions controls which parts of a tree are considered by a directory
+// watch.
+type dirOptions struct {
+	// Exclude holds extra patterns, in .gitignore syntax, relative to the
+	// watched directory.
+	Exclude []string `json:",omitempty"`
+	// MaxDepth limits how deep the tree is walked. 0 means no limit.
+	MaxDepth int `json:",omitempty"`
+	// NoGitignore disables reading the .gitignore files found in the tree.
+	NoGitignore bool `json:",omitempty"`
+}
+
+// dirFingerprint walks the tree under root and summarizes the paths, sizes
+// and modification times of everything that isn't ignored into a single
+// number. Sub-directories are walked in parallel.
+func dirFingerprint(root string, opts *dirOptions) (int64, error) {
+	if opts == nil {
+		opts = &dirOptions{}
+	}
+
+	w := &dirWalker{
+		opts: opts,
+		sem:  make(chan struct{}, runtime.NumCPU()),
+	}
+
+	var rules []ignoreRule
+	if !opts.NoGitignore {
+		rules = append(rules, mustIgnoreRule("", ".git"))
+	}
+	for _, pattern := range opts.Exclude {
+		if rule, ok := parseIgnoreRule("", pattern); ok {
+			rules = append(rules, rule)
+		}
+	}
+
+	sum, err := w.walk(root, "", 1, rules)
+	return int64(sum), err
+}
+
+type dirWalker struct {
+	opts *dirOptions
+	sem  chan struct{}
+}
+
+func (w *dirWalker) walk(dir, rel string, depth int, rules []ignoreRule) (uint64, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	if !w.opts.NoGitignore {
+		rules = append(rules[:len(rules):len(rules)], readGitignore(dir, rel)...)
+	}
+
+	type subdir struct {
+		walked bool
+		sum    uint64
+		err    error
+	}
+	var (
+		wg      sync.WaitGroup
+		subdirs = make([]subdir, len(entries))
+		buf     [8]byte
+	)
+
+	h := fnv.New64a()
+	for idx, entry := range entries {
+		entryRel := path.Join(rel, entry.Name())
+		if ignored(rules, entryRel, entry.IsDir()) {
+			continue
+		}
+
+		_, _ = h.Write([]byte(entry.Name()))
+		_, _ = h.Write([]byte{0})
+
+		if !entry.IsDir() {
+			// Directory times change whenever an entry is added or removed,
+			// including ignored ones, so they are only recorded for files.
+			binary.LittleEndian.PutUint64(buf[:], uint64(entry.ModTime().UnixNano()))
+			_, _ = h.Write(buf[:])
+			binary.LittleEndian.PutUint64(buf[:], uint64(entry.Size()))
+			_, _ = h.Write(buf[:])
+			continue
+		}
+
+		if w.opts.MaxDepth > 0 && depth >= w.opts.MaxDepth {
+			continue
+		}
+
+		walkSubdir := func(idx int, name string) {
+			sum, err := w.walk(filepath.Join(dir, name), path.Join(rel, name), depth+1, rules)
+			subdirs[idx] = subdir{true, sum, err}
+		}
+
+		// Walk in a new goroutine if a slot is free, otherwise inline so
+		// that deep trees can't exhaust the slots and deadlock.
+		select {
+		case w.sem <- struct{}{}:
+			wg.Add(1)
+			go func(idx int, name string) {
+				defer wg.Done()
+				defer func() { <-w.sem }()
+				walkSubdir(idx, name)
+			}(idx, entry.Name())
+		default:
+			walkSubdir(idx, entry.Name())
+		}
+	}
+	wg.Wait()
+
+	for idx := range subdirs {
+		if !subdirs[idx].walked {
+			continue
+		}
+		if subdirs[idx].err != nil {
+			return 0, subdirs[idx].err
+		}
+		binary.LittleEndian.PutUint64(buf[:], subdirs[idx].sum)
+		_, _ = h.Write(buf[:])
+	}
+
+	return h.Sum64(), nil
+}
+
+// ignoreRule is a single .gitignore pattern
+type ignoreRule struct {
+	// base is the directory, relative to the watched one, that the rule
+	// was read from.
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+func readGitignore(dir, rel string) (rules []ignoreRule) {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(rel, scanner.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return
+}
+
+func mustIgnoreRule(base, pattern string) ignoreRule {
+	rule, ok := parseIgnoreRule(base, pattern)
+	if !ok {
+		panic("invalid ignore pattern: " + pattern)
+	}
+	return rule
+}
+
+// parseIgnoreRule parses a line of a .gitignore file. Blank lines and
+// comments are reported as not ok.
+func parseIgnoreRule(base, pattern string) (rule ignoreRule, ok bool) {
+	rule.base = base
+
+	pattern = strings.TrimRight(pattern, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return
+	}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return
+	}
+
+	// Patterns without a slash match at any level below the base
+	prefix := "(^|.*/)"
+	if strings.Contains(pattern, "/") {
+		prefix = "^"
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+
+	re, err := regexp.Compile(prefix + globToRegexp(pattern) + "$")
+	if err != nil {
+		logDebug("ignoring invalid pattern %q: %v", pattern, err)
+		return
+	}
+	rule.re = re
+
+	return rule, true
+}
+
+// globToRegexp translates the .gitignore flavour of globs, including `**`,
+// into a regular expression.
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return sb.String()
+}
+
+// ignored returns whether rel, a slash-separated path relative to the
+// watched directory, is excluded. Like git, the last matching rule wins.
+func ignored(rules []ignoreRule, rel string, isDir bool) (ignore bool) {
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		p := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			p = rel[len(rule.base)+1:]
+		}
+		if rule.re.MatchString(p) {
+			ignore = !rule.negate
+		}
+	}
+	return
+}
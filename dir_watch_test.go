@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	rules := []ignoreRule{
+		mustIgnoreRule("", "node_modules/"),
+		mustIgnoreRule("", "*.log"),
+		mustIgnoreRule("", "!keep.log"),
+		mustIgnoreRule("", "/build"),
+		mustIgnoreRule("sub", "docs/**/*.md"),
+	}
+
+	cases := []struct {
+		rel    string
+		isDir  bool
+		expect bool
+	}{
+		{"node_modules", true, true},
+		{"a/node_modules", true, true},
+		{"node_modules", false, false},
+		{"debug.log", false, true},
+		{"a/b/debug.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"a/build", true, false},
+		{"sub/docs/x.md", false, true},
+		{"sub/docs/a/b/x.md", false, true},
+		{"docs/x.md", false, false},
+		{"main.go", false, false},
+	}
+
+	for _, c := range cases {
+		if got := ignored(rules, c.rel, c.isDir); got != c.expect {
+			t.Errorf("ignored(%q, %v) = %v, expected %v", c.rel, c.isDir, got, c.expect)
+		}
+	}
+}
+
+func TestDirFingerprint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "direnv-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string) {
+		path := filepath.Join(dir, name)
+		_ = os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_ = ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte("node_modules/\n"), 0644)
+	write("src/main.go")
+	write("src/a/main.go")
+
+	opts := &dirOptions{Exclude: []string{"*.log"}, MaxDepth: 2}
+	before, err := dirFingerprint(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write("node_modules/pkg/index.js")
+	write("src/debug.log")
+	write("src/a/b/deep.go")
+	write(".git/HEAD")
+	if after, _ := dirFingerprint(dir, opts); after != before {
+		t.Error("Fingerprint changed because of an ignored file")
+	}
+
+	write("src/lib.go")
+	if after, _ := dirFingerprint(dir, opts); after == before {
+		t.Error("Fingerprint didn't change when a file was added")
+	}
+}
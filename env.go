@@ -83,14 +83,18 @@ func (env Env) ToGoEnv() []string {
 
 // ToShell outputs the environment into an evaluatable string that is
 // understood by the target shell
-func (env Env) ToShell(shell Shell) string {
+func (env Env) ToShell(shell Shell) (string, error) {
 	e := make(ShellExport)
 
 	for key, value := range env {
 		e.Add(key, value)
 	}
 
-	return shell.Export(e)
+	shell, e, err := prepareExport(shell, e)
+	if err != nil {
+		return "", err
+	}
+	return shell.Export(e), nil
 }
 
 // Serialize marshals the env into the gzenv format
@@ -2,8 +2,11 @@ package main
 
 import (
 	"fmt"
+	"hash/fnv"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync"
 	"time"
 
 	"github.com/direnv/direnv/v2/gzenv"
@@ -14,8 +17,25 @@ type FileTime struct {
 	Path    string
 	Modtime int64
 	Exists  bool
+	// Kind is empty for regular file watches. Other kinds re-use Path and
+	// Modtime with a meaning of their own.
+	Kind string `json:",omitempty"`
+	// Dir holds the options of a directory watch.
+	Dir *dirOptions `json:",omitempty"`
 }
 
+const (
+	// expireKind marks a FileTime that holds a deadline in Modtime instead of
+	// a file modification time.
+	expireKind = "expire"
+	// globKind marks a FileTime that holds a glob pattern in Path and a digest
+	// of the matching paths in Modtime.
+	globKind = "glob"
+	// dirKind marks a FileTime that holds a directory in Path and a
+	// fingerprint of the tree under it in Modtime.
+	dirKind = "dir"
+)
+
 // FileTimes represent a record of all the known files and times
 type FileTimes struct {
 	list *[]FileTime
@@ -52,8 +72,6 @@ func (times *FileTimes) Update(path string) (err error) {
 // NewTime add the file on path, with modtime and exists flag to the list of known
 // files.
 func (times *FileTimes) NewTime(path string, modtime int64, exists bool) (err error) {
-	var time *FileTime
-
 	path, err = filepath.Abs(path)
 	if err != nil {
 		return
@@ -61,24 +79,82 @@ func (times *FileTimes) NewTime(path string, modtime int64, exists bool) (err er
 
 	path = filepath.Clean(path)
 
-	for idx := range *(times.list) {
-		if (*times.list)[idx].Path == path {
-			time = &(*times.list)[idx]
-			break
+	time := times.find("", path)
+	time.Modtime = modtime
+	time.Exists = exists
+
+	return
+}
+
+// Glob records the files currently matching the pattern, along with a digest
+// of the match set so that files created or removed later are noticed.
+func (times *FileTimes) Glob(pattern string) (err error) {
+	pattern, err = filepath.Abs(pattern)
+	if err != nil {
+		return
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+	}
+
+	for _, path := range matches {
+		if err = times.Update(path); err != nil {
+			return
 		}
 	}
-	if time == nil {
-		newTimes := append(*times.list, FileTime{Path: path})
-		times.list = &newTimes
-		time = &((*times.list)[len(*times.list)-1])
+
+	time := times.find(globKind, pattern)
+	time.Modtime = globDigest(matches)
+	time.Exists = true
+
+	return
+}
+
+// Dir records a fingerprint of the tree under the path. Unlike adding each
+// file individually, the size of the record doesn't grow with the tree.
+func (times *FileTimes) Dir(path string, opts *dirOptions) (err error) {
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return
+	}
+
+	fingerprint, err := dirFingerprint(path, opts)
+	if err != nil {
+		return
 	}
 
-	time.Modtime = modtime
-	time.Exists = exists
+	time := times.find(dirKind, path)
+	time.Modtime = fingerprint
+	time.Exists = true
+	time.Dir = opts
 
 	return
 }
 
+// Expire records a deadline after which the watches are considered stale. If
+// a deadline is already known, the earliest of the two is kept.
+func (times *FileTimes) Expire(deadline time.Time) {
+	expiry := times.find(expireKind, "")
+	if !expiry.Exists || deadline.Unix() < expiry.Modtime {
+		expiry.Modtime = deadline.Unix()
+		expiry.Exists = true
+	}
+}
+
+// find returns the entry of the given kind and path, adding it if missing.
+func (times *FileTimes) find(kind, path string) *FileTime {
+	for idx := range *times.list {
+		if time := &(*times.list)[idx]; time.Kind == kind && time.Path == path {
+			return time
+		}
+	}
+	newTimes := append(*times.list, FileTime{Path: path, Kind: kind})
+	times.list = &newTimes
+	return &((*times.list)[len(*times.list)-1])
+}
+
 type checkFailed struct {
 	message string
 }
@@ -87,13 +163,29 @@ func (err checkFailed) Error() string {
 	return err.message
 }
 
-// Check validates all the recorded file times
+// Check validates all the recorded file times. The entries are checked in
+// parallel as directory watches can take a while.
 func (times *FileTimes) Check() (err error) {
-	if len(*times.list) == 0 {
+	list := *times.list
+	if len(list) == 0 {
 		return checkFailed{"Times list is empty"}
 	}
-	for idx := range *times.list {
-		err = (*times.list)[idx].Check()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(list))
+	sem := make(chan struct{}, runtime.NumCPU())
+	for idx := range list {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(idx int) {
+			defer wg.Done()
+			errs[idx] = list[idx].Check()
+			<-sem
+		}(idx)
+	}
+	wg.Wait()
+
+	for _, err = range errs {
 		if err != nil {
 			return
 		}
@@ -118,6 +210,15 @@ func (times *FileTimes) CheckOne(path string) (err error) {
 
 // Check verifies that the file is good and hasn't changed
 func (times FileTime) Check() (err error) {
+	switch times.Kind {
+	case expireKind:
+		return times.checkExpire()
+	case globKind:
+		return times.checkGlob()
+	case dirKind:
+		return times.checkDir()
+	}
+
 	stat, err := getLatestStat(times.Path)
 
 	switch {
@@ -137,16 +238,83 @@ func (times FileTime) Check() (err error) {
 			times.Path, stat.ModTime().Unix(), times.Modtime)
 		return checkFailed{fmt.Sprintf("File %q has changed", times.Path)}
 	}
-	logDebug("Check: %s: up to date", times.Path)
+	logTrace("Check: %s: up to date", times.Path)
+	return nil
+}
+
+func (times FileTime) checkExpire() error {
+	if now := time.Now().Unix(); now >= times.Modtime {
+		logDebug("Check: expired %ds ago", now-times.Modtime)
+		return checkFailed{"Environment has expired"}
+	}
+	logTrace("Check: expires in %ds", times.Modtime-time.Now().Unix())
+	return nil
+}
+
+func (times FileTime) checkGlob() error {
+	matches, err := filepath.Glob(times.Path)
+	if err != nil {
+		logDebug("Glob Check: %s: ERR: %v", times.Path, err)
+		return err
+	}
+	if globDigest(matches) != times.Modtime {
+		logDebug("Glob Check: %s: matches changed", times.Path)
+		return checkFailed{fmt.Sprintf("Files matching %q have changed", times.Path)}
+	}
+	logTrace("Glob Check: %s: up to date", times.Path)
+	return nil
+}
+
+func (times FileTime) checkDir() error {
+	fingerprint, err := dirFingerprint(times.Path, times.Dir)
+	switch {
+	case os.IsNotExist(err):
+		logDebug("Dir Check: %s: gone", times.Path)
+		return checkFailed{fmt.Sprintf("Directory %q is missing", times.Path)}
+	case err != nil:
+		logDebug("Dir Check: %s: ERR: %v", times.Path, err)
+		return err
+	case fingerprint != times.Modtime:
+		logDebug("Dir Check: %s: stale", times.Path)
+		return checkFailed{fmt.Sprintf("Directory %q has changed", times.Path)}
+	}
+	logTrace("Dir Check: %s: up to date", times.Path)
 	return nil
 }
 
+// globDigest summarizes a list of glob matches into a single number. The
+// matches are expected to be sorted, which filepath.Glob guarantees.
+func globDigest(matches []string) int64 {
+	h := fnv.New64a()
+	for _, path := range matches {
+		_, _ = h.Write([]byte(path))
+		_, _ = h.Write([]byte{0})
+	}
+	return int64(h.Sum64())
+}
+
 // Formatted shows the times in a user-friendly format.
 func (times *FileTime) Formatted(relDir string) string {
 	timeBytes, err := time.Unix(times.Modtime, 0).MarshalText()
 	if err != nil {
 		timeBytes = []byte("<<???>>")
 	}
+	switch times.Kind {
+	case expireKind:
+		return fmt.Sprintf("expires at %s", timeBytes)
+	case globKind:
+		pattern, err := filepath.Rel(relDir, times.Path)
+		if err != nil {
+			pattern = times.Path
+		}
+		return fmt.Sprintf("glob %q", pattern)
+	case dirKind:
+		dir, err := filepath.Rel(relDir, times.Path)
+		if err != nil {
+			dir = times.Path
+		}
+		return fmt.Sprintf("dir %q - %016x", dir, uint64(times.Modtime))
+	}
 	path, err := filepath.Rel(relDir, times.Path)
 	if err != nil {
 		path = times.Path
@@ -185,11 +353,11 @@ func getLatestStat(path string) (os.FileInfo, error) {
 	statModTime = stat.ModTime().Unix()
 
 	if lstatModTime > statModTime {
-		logDebug("getLatestStat: %s: Lstat: %v, Stat: %v -> preferring Lstat",
+		logTrace("getLatestStat: %s: Lstat: %v, Stat: %v -> preferring Lstat",
 			path, lstatModTime, statModTime)
 		return lstat, nil
 	}
-	logDebug("getLatestStat: %s: Lstat: %v, Stat: %v -> preferring Stat",
+	logTrace("getLatestStat: %s: Lstat: %v, Stat: %v -> preferring Stat",
 		path, lstatModTime, statModTime)
 	return stat, nil
 }
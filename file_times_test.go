@@ -3,6 +3,9 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -20,7 +23,7 @@ func TestUpdate(t *testing.T) {
 }
 
 func TestFTJsons(t *testing.T) {
-	ft := FileTime{"something.txt", time.Now().Unix(), true}
+	ft := FileTime{Path: "something.txt", Modtime: time.Now().Unix(), Exists: true}
 	marshalled, err := json.Marshal(ft)
 	if err != nil {
 		t.Error("FileTime failed to marshal:", err)
@@ -95,3 +98,48 @@ func TestCheckGone(t *testing.T) {
 		t.Error("Check that should fail because gone passes")
 	}
 }
+
+func TestCheckExpired(t *testing.T) {
+	fts := NewFileTimes()
+	_ = fts.Update("file_times.go")
+	fts.Expire(time.Now().Add(time.Hour))
+	if err := fts.Check(); err != nil {
+		t.Error("Check that should pass before the deadline fails with:", err)
+	}
+
+	fts.Expire(time.Now().Add(-time.Second))
+	if len(*fts.list) != 2 {
+		t.Error("Expire should keep a single deadline")
+	}
+	if err := fts.Check(); err == nil {
+		t.Error("Check that should fail because expired passes")
+	}
+}
+
+func TestCheckGlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "direnv-glob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_ = ioutil.WriteFile(filepath.Join(dir, "a.yml"), []byte("a"), 0644)
+
+	fts := NewFileTimes()
+	if err = fts.Glob(filepath.Join(dir, "*.yml")); err != nil {
+		t.Fatal(err)
+	}
+	if err = fts.Check(); err != nil {
+		t.Error("Check that should pass fails with:", err)
+	}
+
+	_ = ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644)
+	if err = fts.Check(); err != nil {
+		t.Error("Check that should ignore non-matching files fails with:", err)
+	}
+
+	_ = ioutil.WriteFile(filepath.Join(dir, "b.yml"), []byte("b"), 0644)
+	if err = fts.Check(); err == nil {
+		t.Error("Check that should fail because a file was added passes")
+	}
+}
@@ -7,4 +7,5 @@ require (
 	github.com/direnv/go-dotenv v0.0.0-20181227095604-4cce6d1a66f7
 	github.com/mattn/go-isatty v0.0.12
 	golang.org/x/mod v0.4.1
+	golang.org/x/sys v0.0.0-20200116001909-b77594299b42
 )
@@ -1,35 +1,99 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	defaultLogFormat        = "direnv: %s"
 	errorLogFormat          = defaultLogFormat
 	errorLogFormatWithColor = "\033[31mdirenv: %s\033[0m"
+	warnLogFormatWithColor  = "\033[33mdirenv: %s\033[0m"
+
+	// jsonLogFormat is the DIRENV_LOG_FORMAT that switches all the messages
+	// to one JSON object per line
+	jsonLogFormat = "json"
+)
+
+// logLevel is the verbosity of the messages, set with DIRENV_LOG_LEVEL
+type logLevel int
+
+const (
+	levelError logLevel = iota
+	levelWarn
+	levelInfo
+	levelDebug
+	levelTrace
 )
 
-var debugging bool
-var noColor = os.Getenv("TERM") == "dumb"
+var logLevelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+func (l logLevel) String() string {
+	return logLevelNames[l]
+}
+
+func parseLogLevel(name string) (logLevel, error) {
+	for i, n := range logLevelNames {
+		if strings.EqualFold(name, n) {
+			return logLevel(i), nil
+		}
+	}
+	return levelInfo, fmt.Errorf("unknown log level '%s', expected one of %s", name, strings.Join(logLevelNames, ", "))
+}
+
+var (
+	currentLogLevel = levelInfo
+	logJSON         bool
+	noColor         = os.Getenv("TERM") == "dumb"
+
+	// The messages are written in one go while holding logMu so that the
+	// goroutines don't interleave them.
+	logMu     sync.Mutex
+	logOutput io.Writer = os.Stderr
+)
 
 func setupLogging(env Env) {
 	log.SetFlags(0)
 	log.SetPrefix("")
+
+	currentLogLevel = levelInfo
 	if val, ok := env[DIRENV_DEBUG]; ok && val == "1" {
-		debugging = true
-		log.SetFlags(log.Ltime)
-		log.SetPrefix("direnv: ")
+		currentLogLevel = levelDebug
+	}
+	logJSON = env["DIRENV_LOG_FORMAT"] == jsonLogFormat
+
+	if name := env["DIRENV_LOG_LEVEL"]; name != "" {
+		level, err := parseLogLevel(name)
+		if err != nil {
+			logWarn("invalid DIRENV_LOG_LEVEL: %v", err)
+			return
+		}
+		currentLogLevel = level
 	}
 }
 
 func logError(msg string, a ...interface{}) {
 	if noColor {
-		logMsg(errorLogFormat, msg, a...)
+		logMsg(levelError, errorLogFormat, msg, a...)
+	} else {
+		logMsg(levelError, errorLogFormatWithColor, msg, a...)
+	}
+}
+
+func logWarn(msg string, a ...interface{}) {
+	if noColor {
+		logMsg(levelWarn, defaultLogFormat, msg, a...)
 	} else {
-		logMsg(errorLogFormatWithColor, msg, a...)
+		logMsg(levelWarn, warnLogFormatWithColor, msg, a...)
 	}
 }
 
@@ -39,26 +103,114 @@ func logStatus(env Env, msg string, a ...interface{}) {
 		format = defaultLogFormat
 	}
 	if format != "" {
-		logMsg(format, msg, a...)
+		logMsg(levelInfo, format, msg, a...)
 	}
 }
 
 func logDebug(msg string, a ...interface{}) {
-	if !debugging {
+	logCaller(levelDebug, msg, a...)
+}
+
+// logTrace is for the messages that are too noisy for debugging, like the
+// ones emitted for every watched file.
+func logTrace(msg string, a ...interface{}) {
+	logCaller(levelTrace, msg, a...)
+}
+
+// logCaller logs with the time and the location of the call. The prefix of
+// the standard logger is used to add some context to the message.
+func logCaller(level logLevel, msg string, a ...interface{}) {
+	if level > currentLogLevel {
 		return
 	}
-	defer log.SetFlags(log.Flags())
-	log.SetFlags(log.Flags() | log.Lshortfile)
+	caller := "???:0"
+	if _, file, line, ok := runtime.Caller(2); ok {
+		caller = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
 	msg = fmt.Sprintf(msg, a...)
-	_ = log.Output(2, msg)
-}
 
-func logMsg(format, msg string, a ...interface{}) {
-	defer log.SetFlags(log.Flags())
-	defer log.SetPrefix(log.Prefix())
-	log.SetFlags(0)
-	log.SetPrefix("")
+	if logJSON {
+		logWriteJSON(level, msg, caller)
+		return
+	}
+	logWrite(fmt.Sprintf("direnv: %s%s %s: %s\n", log.Prefix(), time.Now().Format("15:04:05"), caller, msg))
+}
 
+func logMsg(level logLevel, format, msg string, a ...interface{}) {
+	if level > currentLogLevel {
+		return
+	}
+	if logJSON || format == jsonLogFormat {
+		logWriteJSON(level, fmt.Sprintf(msg, a...), "")
+		return
+	}
 	msg = fmt.Sprintf(format+"\n", msg)
-	log.Printf(msg, a...)
+	logWrite(fmt.Sprintf(msg, a...))
+}
+
+func logWriteJSON(level logLevel, msg, caller string) {
+	entry := struct {
+		Time   string `json:"time"`
+		Level  string `json:"level"`
+		Msg    string `json:"msg"`
+		Caller string `json:"caller,omitempty"`
+	}{time.Now().Format(time.RFC3339Nano), level.String(), msg, caller}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	logWrite(string(data) + "\n")
+}
+
+func logWrite(line string) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	_, _ = io.WriteString(logOutput, line)
+}
+
+// loadRecord is what gets appended to the log_file for each load and unload
+type loadRecord struct {
+	Time     string  `json:"time"`
+	Event    string  `json:"event"`
+	Dir      string  `json:"dir"`
+	Duration float64 `json:"duration"`
+	Outcome  string  `json:"outcome"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// logLoad appends a record to the log_file, if one is configured.
+func logLoad(config *Config, event, dir string, start time.Time, err error) {
+	if config.LogFile == "" {
+		return
+	}
+
+	record := loadRecord{
+		Time:     start.Format(time.RFC3339Nano),
+		Event:    event,
+		Dir:      dir,
+		Duration: time.Since(start).Seconds(),
+		Outcome:  "ok",
+	}
+	if err != nil {
+		record.Outcome = "error"
+		record.Error = err.Error()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	f, err := os.OpenFile(config.LogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		logDebug("log_file: %v", err)
+		return
+	}
+	defer f.Close()
+
+	// A single write keeps the records of concurrent shells apart
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		logDebug("log_file: %v", err)
+	}
 }
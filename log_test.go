@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func withLogOutput(t *testing.T, env Env) *bytes.Buffer {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	output := logOutput
+	logOutput = buf
+	setupLogging(env)
+	t.Cleanup(func() {
+		logOutput = output
+		setupLogging(Env{})
+	})
+	return buf
+}
+
+func TestLogLevels(t *testing.T) {
+	buf := withLogOutput(t, Env{"DIRENV_LOG_LEVEL": "warn", DIRENV_DEBUG: "1"})
+
+	logDebug("debug")
+	logStatus(Env{}, "status")
+	logWarn("warn")
+
+	if out := buf.String(); strings.Contains(out, "debug") || strings.Contains(out, "status") || !strings.Contains(out, "warn") {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestLogJSON(t *testing.T) {
+	buf := withLogOutput(t, Env{"DIRENV_LOG_FORMAT": "json", DIRENV_DEBUG: "1"})
+
+	// Messages from concurrent goroutines stay on their own line
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			logDebug("message %d", i)
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("expected 10 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		var entry map[string]string
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry["level"] != "debug" || !strings.HasPrefix(entry["msg"], "message ") || !strings.HasPrefix(entry["caller"], "log_test.go:") {
+			t.Errorf("unexpected entry %v", entry)
+		}
+	}
+}
+
+// stdlibLog runs script with the stdlib and returns what it logs
+func stdlibLog(t *testing.T, env Env, script string) string {
+	bashPath, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not in PATH")
+	}
+	dir, err := ioutil.TempDir("", "direnv-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path, err := stdlibPath(&Config{CacheDir: dir, SelfPath: "direnv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env["TERM"] = "dumb"
+	cmd := exec.Command(bashPath, "--noprofile", "--norc", "-c", `source "`+path+`" && `+script)
+	cmd.Env = env.ToGoEnv()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	return stderr.String()
+}
+
+func TestStdlibLogJSON(t *testing.T) {
+	msg := "say \"hi\"\\\n\tbye"
+	goLine := withLogOutput(t, Env{"DIRENV_LOG_FORMAT": "json"})
+	logStatus(Env{}, "%s", msg)
+	stdlibLine := stdlibLog(t, Env{"DIRENV_LOG_FORMAT": "json", "MSG": msg}, `log_status "$MSG"`)
+
+	var goEntry, stdlibEntry map[string]string
+	if err := json.Unmarshal(goLine.Bytes(), &goEntry); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(stdlibLine), &stdlibEntry); err != nil {
+		t.Fatalf("%v: %q", err, stdlibLine)
+	}
+
+	if len(stdlibEntry) != len(goEntry) {
+		t.Errorf("expected the fields of %v, got %v", goEntry, stdlibEntry)
+	}
+	for _, entry := range []map[string]string{goEntry, stdlibEntry} {
+		if _, err := time.Parse(time.RFC3339, entry["time"]); err != nil {
+			t.Errorf("invalid time in %v: %v", entry, err)
+		}
+		if entry["level"] != "info" || entry["msg"] != msg {
+			t.Errorf("unexpected entry %v", entry)
+		}
+	}
+}
+
+func TestStdlibLogLevels(t *testing.T) {
+	script := `log_status status; log_error error`
+
+	cases := []struct {
+		env    Env
+		expect string
+	}{
+		{Env{}, "status\nerror\n"},
+		{Env{"DIRENV_LOG_LEVEL": "WARN"}, "error\n"},
+		{Env{"DIRENV_LOG_LEVEL": "error"}, "error\n"},
+		{Env{"DIRENV_LOG_LEVEL": "debug"}, "status\nerror\n"},
+		{Env{"DIRENV_LOG_LEVEL": "unknown"}, "status\nerror\n"},
+	}
+	for _, c := range cases {
+		c.env["DIRENV_LOG_FORMAT"] = "%s"
+		if out := stdlibLog(t, c.env, script); out != c.expect {
+			t.Errorf("%v: expected %q, got %q", c.env, c.expect, out)
+		}
+	}
+}
@@ -18,6 +18,9 @@ func main() {
 	setupLogging(env)
 
 	err := CommandsDispatch(env, args)
+	if status, ok := err.(exitStatus); ok {
+		os.Exit(int(status))
+	}
 	if err != nil {
 		logError("error %v", err)
 		os.Exit(1)
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// outputFile is a temporary file that the .envrc writes its output to.
+// Unlike with a pipe, the load doesn't wait for the background processes
+// started by the .envrc, which inherit the file, to close it.
+type outputFile struct {
+	*os.File
+	// reader has its own offset, so that reading doesn't move the one that
+	// the .envrc writes at
+	reader *os.File
+}
+
+func newOutputFile() (*outputFile, error) {
+	file, err := ioutil.TempFile("", "direnv-output")
+	if err != nil {
+		return nil, err
+	}
+	reader, err := os.Open(file.Name())
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &outputFile{file, reader}, nil
+}
+
+// ReadNew returns what was written since the last read
+func (o *outputFile) ReadNew() ([]byte, error) {
+	return ioutil.ReadAll(o.reader)
+}
+
+// Follow copies what is written to the file to w every interval, until the
+// returned function is first called, which copies the rest.
+func (o *outputFile) Follow(w io.Writer, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				_, _ = io.Copy(w, o.reader)
+				return
+			case <-ticker.C:
+				_, _ = io.Copy(w, o.reader)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+}
+
+// Close closes and removes the file
+func (o *outputFile) Close() error {
+	o.reader.Close()
+	o.File.Close()
+	return os.Remove(o.Name())
+}
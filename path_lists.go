@@ -0,0 +1,57 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+)
+
+// defaultPathLists are used when direnv.toml doesn't set path_lists
+var defaultPathLists = []string{"*PATH", "*_DIRS"}
+
+// pathListPolicy decides which variables hold a list of paths, joined with
+// the path list separator. The shells that have lists export them as lists.
+// The nil policy uses the default patterns.
+type pathListPolicy struct {
+	patterns []string
+}
+
+func newPathListPolicy(patterns []string) *pathListPolicy {
+	return &pathListPolicy{patterns}
+}
+
+// IsPathList returns true if the value of key is a list of paths
+func (p *pathListPolicy) IsPathList(key string) bool {
+	patterns := defaultPathLists
+	if p != nil {
+		patterns = p.patterns
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPathList returns the entries of the list of paths. Unlike
+// filepath.SplitList, the empty entries are kept so that joining the entries
+// gives back the value.
+func splitPathList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var entries []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		if value[i] == filepath.ListSeparator {
+			entries = append(entries, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(entries, value[start:])
+}
+
+// PathListPolicy returns the configured policy
+func (config *Config) PathListPolicy() *pathListPolicy {
+	return newPathListPolicy(config.PathLists)
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -18,6 +19,7 @@ import (
 type RC struct {
 	path      string
 	allowPath string
+	denyPath  string
 	times     FileTimes
 	config    *Config
 }
@@ -40,6 +42,7 @@ func RCFromPath(path string, config *Config) (*RC, error) {
 	}
 
 	allowPath := filepath.Join(config.AllowDir(), hash)
+	denyPath := filepath.Join(config.DenyDir(), hash)
 
 	times := NewFileTimes()
 
@@ -53,7 +56,7 @@ func RCFromPath(path string, config *Config) (*RC, error) {
 		return nil, err
 	}
 
-	return &RC{path, allowPath, times, config}, nil
+	return &RC{path, allowPath, denyPath, times, config}, nil
 }
 
 // RCFromEnv inits the RC from the environment
@@ -63,7 +66,7 @@ func RCFromEnv(path, marshalledTimes string, config *Config) *RC {
 	if err != nil {
 		return nil
 	}
-	return &RC{path, "", times, config}
+	return &RC{path, "", "", times, config}
 }
 
 // Allow grants the RC as allowed to load
@@ -77,44 +80,75 @@ func (rc *RC) Allow() (err error) {
 	if err = allow(rc.path, rc.allowPath); err != nil {
 		return
 	}
+	if err = os.Remove(rc.denyPath); err != nil && !os.IsNotExist(err) {
+		return
+	}
 	err = rc.times.Update(rc.allowPath)
 	return
 }
 
-// Deny revokes the permission of the RC file to load
-func (rc *RC) Deny() error {
-	return os.Remove(rc.allowPath)
+// Deny revokes the permission of the RC file to load, and records that it
+// was denied on purpose
+func (rc *RC) Deny() (err error) {
+	if err = os.MkdirAll(filepath.Dir(rc.denyPath), 0755); err != nil {
+		return
+	}
+	if err = allow(rc.path, rc.denyPath); err != nil {
+		return
+	}
+	if err = os.Remove(rc.allowPath); os.IsNotExist(err) {
+		err = nil
+	}
+	return
 }
 
+// The possible answers of AllowStatus
+const (
+	allowStatusAllowed     = "allowed"
+	allowStatusWhitelisted = "whitelisted"
+	allowStatusDenied      = "denied"
+	allowStatusBlocked     = "blocked"
+)
+
 // Allowed checks if the RC file has been granted loading
 func (rc *RC) Allowed() bool {
+	status, _ := rc.AllowStatus()
+	return status == allowStatusAllowed || status == allowStatusWhitelisted
+}
+
+// AllowStatus tells whether the RC file can be loaded, and why
+func (rc *RC) AllowStatus() (status string, reason string) {
 	// happy path is if this envrc has been explicitly allowed, O(1)ish common case
 	_, err := os.Stat(rc.allowPath)
 
 	if err == nil {
-		return true
+		return allowStatusAllowed, "allowed with `direnv allow`"
 	}
 
 	// when whitelisting we want to be (path) absolutely sure we've not been duped with a symlink
 	path, err := filepath.Abs(rc.path)
 	// seems unlikely that we'd hit this, but have to handle it
 	if err != nil {
-		return false
+		return allowStatusBlocked, err.Error()
 	}
 
 	// exact whitelists are O(1)ish to check, so look there first
 	if rc.config.WhitelistExact[path] {
-		return true
+		return allowStatusWhitelisted, fmt.Sprintf("%s is in whitelist.exact", path)
 	}
 
 	// finally we check if any of our whitelist prefixes match
 	for _, prefix := range rc.config.WhitelistPrefix {
 		if strings.HasPrefix(path, prefix) {
-			return true
+			return allowStatusWhitelisted, fmt.Sprintf("%s is in whitelist.prefix", prefix)
 		}
 	}
 
-	return false
+	if _, err = os.Stat(rc.denyPath); err == nil {
+		return allowStatusDenied, "denied with `direnv deny`"
+	}
+
+	return allowStatusBlocked, "not allowed yet, or changed since it was allowed"
 }
 
 // Path returns the path to the RC file
@@ -134,6 +168,12 @@ const notAllowed = "%s is blocked. Run `direnv allow` to approve its content"
 //
 // This functions is key to the implementation of direnv.
 func (rc *RC) Load(previousEnv Env) (newEnv Env, err error) {
+	return rc.load(previousEnv, "")
+}
+
+// load is Load, with the bash xtrace of the evaluation written to tracePath
+// if it's not empty. See traceSetup for the format.
+func (rc *RC) load(previousEnv Env, tracePath string) (newEnv Env, err error) {
 	config := rc.config
 	wd := config.WorkDir
 	direnv := config.SelfPath
@@ -155,10 +195,24 @@ func (rc *RC) Load(previousEnv Env) (newEnv Env, err error) {
 		prelude = "set -euo pipefail && "
 	}
 
+	// Source the stdlib from the cache to avoid running direnv again and
+	// piping it through bash on every load.
+	loadStdlib := fmt.Sprintf(`eval "$("%s" stdlib)"`, direnv)
+	if path, err := stdlibPath(config); err == nil {
+		loadStdlib = fmt.Sprintf(`source "%s"`, path)
+	} else {
+		logDebug("stdlib cache: %v", err)
+	}
+
+	// The stdlib itself isn't traced
+	if tracePath != "" {
+		loadStdlib += " && " + traceSetup(tracePath)
+	}
+
 	arg := fmt.Sprintf(
-		`%seval "$("%s" stdlib)" && __main__ source_env "%s"`,
+		`%s%s && __main__ source_env "%s"`,
 		prelude,
-		direnv,
+		loadStdlib,
 		rc.Path(),
 	)
 
@@ -178,6 +232,36 @@ func (rc *RC) Load(previousEnv Env) (newEnv Env, err error) {
 	cmd.Env = newEnv.ToGoEnv()
 	cmd.Stderr = os.Stderr
 
+	// The JSON dump is written to a file rather than a pipe, see outputFile
+	stdout, err := newOutputFile()
+	if err != nil {
+		return
+	}
+	defer stdout.Close()
+	cmd.Stdout = stdout.File
+
+	// In quiet mode, only show the output of the .envrc if something goes
+	// wrong: when it fails, or when it's taking longer than WarnTimeout.
+	var stderr *tailBuffer
+	stopFollowing := func() {}
+	if config.QuietLoad {
+		logStatus(previousEnv, "loading %s", userRelPath(previousEnv, rc.Path()))
+		var stderrFile *outputFile
+		if stderrFile, err = newOutputFile(); err != nil {
+			return
+		}
+		defer stderrFile.Close()
+		cmd.Stderr = stderrFile.File
+
+		stderr = newTailBuffer(config.QuietLoadLines)
+		stopFollowing = stderrFile.Follow(stderr, 100*time.Millisecond)
+		defer stopFollowing()
+		timer := time.AfterFunc(config.WarnTimeout, func() {
+			_ = stderr.Flush(os.Stderr)
+		})
+		defer timer.Stop()
+	}
+
 	if config.DisableStdin {
 		cmd.Stdin, err = os.Open(os.DevNull)
 		if err != nil {
@@ -187,10 +271,22 @@ func (rc *RC) Load(previousEnv Env) (newEnv Env, err error) {
 		cmd.Stdin = os.Stdin
 	}
 
-	if out, err := cmd.Output(); err == nil && len(out) > 0 {
-		var newEnv2 Env
-		newEnv2, err = LoadEnvJSON(out)
-		if err == nil {
+	if cmdErr := cmd.Run(); cmdErr != nil {
+		if stderr != nil {
+			stopFollowing()
+			_ = stderr.Flush(os.Stderr)
+		}
+		err = evalError{cmdErr}
+		return
+	}
+
+	out, err := stdout.ReadNew()
+	if err != nil {
+		return
+	}
+
+	if len(out) > 0 {
+		if newEnv2, err := LoadEnvJSON(out); err == nil {
 			newEnv = newEnv2
 		}
 	}
@@ -198,6 +294,27 @@ func (rc *RC) Load(previousEnv Env) (newEnv Env, err error) {
 	return
 }
 
+// evalError is returned by RC.load when the .envrc exits with an error. The
+// env returned along with it, without the changes of the .envrc, is still
+// meant to be applied so that the load isn't retried on every prompt.
+type evalError struct {
+	err error
+}
+
+func (e evalError) Error() string {
+	return fmt.Sprintf("evaluation failed: %v", e.err)
+}
+
+func (e evalError) Unwrap() error {
+	return e.err
+}
+
+// isEvalError returns true if err only means that the .envrc failed
+func isEvalError(err error) bool {
+	var evalErr evalError
+	return errors.As(err, &evalErr)
+}
+
 /// Utils
 
 func eachDir(path string) (paths []string) {
@@ -225,6 +342,16 @@ func eachDir(path string) (paths []string) {
 	return
 }
 
+// userRelPath abbreviates the home directory with ~, like the stdlib's
+// user_rel_path
+func userRelPath(env Env, path string) string {
+	home := env["HOME"]
+	if home != "" && strings.HasPrefix(path, home+"/") {
+		return "~" + path[len(home):]
+	}
+	return path
+}
+
 func fileExists(path string) bool {
 	// Some broken filesystems like SSHFS return file information on stat() but
 	// then cannot open the file. So we use os.Open instead.
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSomething(t *testing.T) {
@@ -18,3 +24,102 @@ func TestSomething(t *testing.T) {
 		}
 	}
 }
+
+func TestAllowStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "direnv-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rcPath := filepath.Join(dir, ".envrc")
+	if err = ioutil.WriteFile(rcPath, []byte("export FOO=bar\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{DataDir: filepath.Join(dir, "data")}
+	rc, err := RCFromPath(rcPath, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(expected string) {
+		t.Helper()
+		if status, _ := rc.AllowStatus(); status != expected {
+			t.Errorf("expected %s, got %s", expected, status)
+		}
+	}
+
+	expect(allowStatusBlocked)
+	if err = rc.Allow(); err != nil {
+		t.Fatal(err)
+	}
+	expect(allowStatusAllowed)
+	if err = rc.Deny(); err != nil {
+		t.Fatal(err)
+	}
+	expect(allowStatusDenied)
+
+	config.WhitelistPrefix = []string{dir}
+	expect(allowStatusWhitelisted)
+}
+
+func TestLoadBackgroundProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "direnv-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bashPath, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not in PATH")
+	}
+
+	// The dump is all that's needed from direnv
+	selfPath := filepath.Join(dir, "direnv")
+	if err = ioutil.WriteFile(selfPath, []byte("#!/bin/sh\n[ \"$1\" != dump ] || echo '{\"FOO\":\"bar\"}'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The background process keeps the stdout and stderr of the .envrc open
+	pidPath := filepath.Join(dir, "pid")
+	rcPath := filepath.Join(dir, ".envrc")
+	if err = ioutil.WriteFile(rcPath, []byte("sleep 10 &\necho $! > "+pidPath+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, quiet := range []bool{false, true} {
+		config := &Config{
+			BashPath:       bashPath,
+			CacheDir:       filepath.Join(dir, "cache"),
+			DataDir:        filepath.Join(dir, "data"),
+			DisableStdin:   true,
+			QuietLoad:      quiet,
+			QuietLoadLines: 10,
+			SelfPath:       selfPath,
+			WarnTimeout:    time.Minute,
+			WorkDir:        dir,
+		}
+		rc, err := RCFromPath(rcPath, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = rc.Allow(); err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		env, err := rc.Load(Env{})
+		if pid, err := ioutil.ReadFile(pidPath); err == nil {
+			_ = exec.Command("kill", strings.TrimSpace(string(pid))).Run()
+		}
+		if err != nil {
+			t.Fatalf("quiet=%v: %v", quiet, err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("quiet=%v: the load waited %v for the background process", quiet, elapsed)
+		}
+		if env["FOO"] != "bar" {
+			t.Errorf("quiet=%v: expected the dumped env, got %v", quiet, env)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"path"
+	"strings"
+)
+
+// redactedValue replaces the value of secrets in the output meant for humans
+const redactedValue = "***"
+
+// defaultSecretPatterns are used when direnv.toml doesn't list any
+var defaultSecretPatterns = []string{"*_TOKEN", "*_SECRET", "*_PASSWORD", "*_API_KEY"}
+
+// secretPolicy decides which variables hold secrets. A variable is secret
+// when its name matches one of the patterns, ignoring case, or when the
+// .envrc marked it with `mark_secret`, which lists it in DIRENV_SECRETS.
+type secretPolicy struct {
+	patterns []string
+	names    map[string]bool
+}
+
+// newSecretPolicy returns the policy for the patterns and the variables
+// marked in any of the envs.
+func newSecretPolicy(patterns []string, envs ...Env) *secretPolicy {
+	p := &secretPolicy{names: make(map[string]bool)}
+	for _, pattern := range patterns {
+		p.patterns = append(p.patterns, strings.ToUpper(pattern))
+	}
+	for _, env := range envs {
+		for _, name := range strings.Split(env[DIRENV_SECRETS], ":") {
+			if name != "" {
+				p.names[name] = true
+			}
+		}
+	}
+	return p
+}
+
+// IsSecret returns true if the value of key must not be shown
+func (p *secretPolicy) IsSecret(key string) bool {
+	if p.names[key] {
+		return true
+	}
+	upper := strings.ToUpper(key)
+	for _, pattern := range p.patterns {
+		if ok, _ := path.Match(pattern, upper); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns the value to display for key
+func (p *secretPolicy) Redact(key, value string) string {
+	if value != "" && p.IsSecret(key) {
+		return redactedValue
+	}
+	return value
+}
+
+// RedactEnv returns a copy of the env with the secret values masked
+func (p *secretPolicy) RedactEnv(env Env) Env {
+	redacted := make(Env, len(env))
+	for key, value := range env {
+		redacted[key] = p.Redact(key, value)
+	}
+	return redacted
+}
+
+// RedactDiff returns a copy of the diff with the secret values masked
+func (p *secretPolicy) RedactDiff(diff *EnvDiff) *EnvDiff {
+	return &EnvDiff{
+		Prev: p.RedactEnv(diff.Prev),
+		Next: p.RedactEnv(diff.Next),
+	}
+}
+
+// RedactAny masks the secret values of the string maps found in data, as
+// decoded from JSON.
+func (p *secretPolicy) RedactAny(data interface{}) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			if s, ok := value.(string); ok {
+				redacted[key] = p.Redact(key, s)
+			} else {
+				redacted[key] = p.RedactAny(value)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, value := range v {
+			redacted[i] = p.RedactAny(value)
+		}
+		return redacted
+	}
+	return data
+}
+
+// Secrets returns the configured policy, with the variables marked in any of
+// the envs.
+func (config *Config) Secrets(envs ...Env) *secretPolicy {
+	return newSecretPolicy(config.SecretPatterns, envs...)
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestSecretPolicy(t *testing.T) {
+	p := newSecretPolicy(defaultSecretPatterns, Env{DIRENV_SECRETS: "DATABASE_URL:OTHER"})
+
+	for key, secret := range map[string]bool{
+		"GITHUB_TOKEN":  true,
+		"github_token":  true,
+		"AWS_SECRET":    true,
+		"DATABASE_URL":  true,
+		"TOKEN":         false,
+		"PATH":          false,
+		"DATABASE_URLS": false,
+	} {
+		if p.IsSecret(key) != secret {
+			t.Errorf("expected IsSecret(%q) to be %v", key, secret)
+		}
+	}
+
+	diff := p.RedactDiff(&EnvDiff{
+		Prev: map[string]string{"GITHUB_TOKEN": "old"},
+		Next: map[string]string{"GITHUB_TOKEN": "new", "PATH": "/bin", "AWS_SECRET": ""},
+	})
+	if diff.Prev["GITHUB_TOKEN"] != redactedValue || diff.Next["GITHUB_TOKEN"] != redactedValue {
+		t.Errorf("expected the token to be redacted, got %v", diff)
+	}
+	if diff.Next["PATH"] != "/bin" || diff.Next["AWS_SECRET"] != "" {
+		t.Errorf("expected the other values to be kept, got %v", diff)
+	}
+}
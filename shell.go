@@ -1,7 +1,13 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
 )
 
 // Shell is the interface that represents the interaction with the host shell.
@@ -17,6 +23,124 @@ type Shell interface {
 	Dump(env Env) string
 }
 
+// shellContext is what the targets may need to know besides the changes
+type shellContext struct {
+	env       Env // the env being changed
+	secrets   *secretPolicy
+	pathLists *pathListPolicy
+}
+
+// contextShell is implemented by the targets whose output depends on the
+// shellContext, and not only on the changes.
+type contextShell interface {
+	withContext(ctx shellContext) Shell
+}
+
+// shellWithContext returns the shell to export the changes with
+func shellWithContext(shell Shell, ctx shellContext) Shell {
+	if s, ok := shell.(contextShell); ok {
+		return s.withContext(ctx)
+	}
+	return shell
+}
+
+// keyShell is implemented by the targets that only support some of the
+// variable names.
+type keyShell interface {
+	checkKey(key string) error
+}
+
+// checkedShell is implemented by the targets that can't represent every
+// value, so that direnv errors out instead of printing a broken output.
+type checkedShell interface {
+	check(key, value string) error
+}
+
+// preparedShell is implemented by the targets that need to do something that
+// can fail before the export, like reading random data.
+type preparedShell interface {
+	prepare() (Shell, error)
+}
+
+// checkKey returns an error if the shell can't represent the variable name.
+// The names that the env itself can't hold are always rejected.
+func checkKey(shell Shell, key string) error {
+	if key == "" || strings.ContainsAny(key, "=\x00") {
+		return errors.New("not a valid variable name")
+	}
+	if c, ok := shell.(keyShell); ok {
+		return c.checkKey(key)
+	}
+	return nil
+}
+
+// shellIdentifierRe matches the variable names of the POSIX shells
+var shellIdentifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func checkIdentifier(key string) error {
+	if !shellIdentifierRe.MatchString(key) {
+		return errors.New("only letters, digits and underscores are supported, not starting with a digit")
+	}
+	return nil
+}
+
+func checkUTF8(key string) error {
+	if !utf8.ValidString(key) {
+		return errors.New("only UTF-8 names are supported")
+	}
+	return nil
+}
+
+// prepareExport leaves out the variables whose name the shell can't
+// represent, so that they can't break or inject into its output, and checks
+// the values of the others. It returns the shell to export them with.
+func prepareExport(shell Shell, e ShellExport) (Shell, ShellExport, error) {
+	valid := make(ShellExport, len(e))
+	for key, value := range e {
+		if err := checkKey(shell, key); err != nil {
+			logWarn("skipping the variable %q: %v", key, err)
+			continue
+		}
+		valid[key] = value
+	}
+	if err := checkExport(shell, valid); err != nil {
+		return shell, valid, err
+	}
+
+	if s, ok := shell.(preparedShell); ok {
+		prepared, err := s.prepare()
+		if err != nil {
+			return shell, valid, err
+		}
+		shell = prepared
+	}
+	return shell, valid, nil
+}
+
+// checkExport returns an error for the first variable set by e that the
+// shell can't represent.
+func checkExport(shell Shell, e ShellExport) error {
+	c, ok := shell.(checkedShell)
+	if !ok {
+		return nil
+	}
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if e[key] == nil {
+			continue
+		}
+		if err := c.check(key, *e[key]); err != nil {
+			return fmt.Errorf("can't export %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
 // ShellExport represents environment variables to add and remove on the host
 // shell.
 type ShellExport map[string]*string
@@ -58,6 +182,26 @@ func DetectShell(target string) Shell {
 		return JSON
 	case "elvish":
 		return Elvish
+	case "nu", "nushell":
+		return Nushell
+	case "pwsh", "powershell":
+		return Pwsh
+	case "xonsh":
+		return Xonsh
+	case "elisp":
+		return Elisp
+	case "tmux":
+		return Tmux
+	case "tmux-session":
+		return TmuxSession
+	case "github-actions":
+		return GitHubActions
+	case "docker-env":
+		return DockerEnv
+	case "systemd":
+		return Systemd
+	case "make":
+		return Make
 	}
 
 	return nil
@@ -46,6 +46,10 @@ func (sh bash) export(key, value string) string {
 	return "export " + sh.escape(key) + "=" + sh.escape(value) + ";"
 }
 
+func (sh bash) checkKey(key string) error {
+	return checkIdentifier(key)
+}
+
 func (sh bash) unset(key string) string {
 	return "unset " + sh.escape(key) + ";"
 }
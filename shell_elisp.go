@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type elisp struct{}
+
+// Elisp adds support for Emacs. The output is a single form to `eval`.
+var Elisp Shell = elisp{}
+
+func (sh elisp) Hook() (string, error) {
+	return "", errors.New("this feature is not supported. Evaluate the output of `direnv export elisp` from Emacs instead")
+}
+
+// Export sets the variables with setenv, where nil removes them. The
+// exec-path is derived from PATH, the way Emacs does at startup.
+func (sh elisp) Export(e ShellExport) string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := "(progn"
+	for _, key := range keys {
+		value := "nil"
+		if e[key] != nil {
+			value = sh.escape(*e[key])
+		}
+		out += "\n  (setenv " + sh.escape(key) + " " + value + ")"
+	}
+	if path, ok := e["PATH"]; ok {
+		out += "\n  " + sh.execPath(path)
+	}
+	return out + ")\n"
+}
+
+func (sh elisp) Dump(env Env) string {
+	e := make(ShellExport, len(env))
+	for key, value := range env {
+		e.Add(key, value)
+	}
+	return sh.Export(e)
+}
+
+func (sh elisp) execPath(path *string) string {
+	var dirs []string
+	if path != nil && *path != "" {
+		for _, dir := range filepath.SplitList(*path) {
+			dirs = append(dirs, sh.escape(dir)+" ")
+		}
+	}
+	return "(setq exec-path (list " + strings.Join(dirs, "") + "exec-directory))"
+}
+
+// escape returns str as an elisp string. The control characters and the
+// invalid UTF-8 bytes are written as octal escapes, which give raw bytes for
+// the latter.
+func (sh elisp) escape(str string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for i := 0; i < len(str); {
+		r, size := utf8.DecodeRuneInString(str[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&out, `\%03o`, str[i])
+		case r == '"' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(&out, `\%03o`, r)
+		default:
+			out.WriteRune(r)
+		}
+		i += size
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
+var (
+	_ Shell = (*elisp)(nil)
+)
@@ -5,20 +5,25 @@ import (
 	"encoding/json"
 )
 
-type elvish struct{}
+type elvish struct {
+	pathLists *pathListPolicy
+}
 
 // Elvish add support for the elvish shell
 var Elvish Shell = elvish{}
 
 func (elvish) Hook() (string, error) {
 	return `## hook for direnv
+use str
 @edit:before-readline = $@edit:before-readline {
 	try {
 		m = [("{{.SelfPath}}" export elvish | from-json)]
 		if (> (count $m) 0) {
 			m = (all $m)
 			keys $m | each [k]{
-				if $m[$k] {
+				if (eq (kind-of $m[$k]) list) {
+					set-env $k (str:join : $m[$k])
+				} elif $m[$k] {
 					set-env $k $m[$k]
 				} else {
 					unset-env $k
@@ -32,24 +37,45 @@ func (elvish) Hook() (string, error) {
 `, nil
 }
 
+func (sh elvish) withContext(ctx shellContext) Shell {
+	return elvish{ctx.pathLists}
+}
+
+// Export outputs a JSON object, where the lists of paths are arrays
 func (sh elvish) Export(e ShellExport) string {
+	values := make(map[string]interface{}, len(e))
+	for key, value := range e {
+		switch {
+		case value == nil:
+			values[key] = nil
+		case sh.pathLists.IsPathList(key):
+			values[key] = append([]string{}, splitPathList(*value)...)
+		default:
+			values[key] = *value
+		}
+	}
+
 	buf := new(bytes.Buffer)
-	err := json.NewEncoder(buf).Encode(e)
+	err := json.NewEncoder(buf).Encode(values)
 	if err != nil {
 		panic(err)
 	}
 	return buf.String()
 }
 
+func (sh elvish) checkKey(key string) error {
+	return checkUTF8(key)
+}
+
 func (sh elvish) Dump(env Env) (out string) {
-	buf := new(bytes.Buffer)
-	err := json.NewEncoder(buf).Encode(env)
-	if err != nil {
-		panic(err)
+	e := make(ShellExport, len(env))
+	for key, value := range env {
+		e.Add(key, value)
 	}
-	return buf.String()
+	return sh.Export(e)
 }
 
 var (
-	_ Shell = (*elvish)(nil)
+	_ Shell        = (*elvish)(nil)
+	_ contextShell = (*elvish)(nil)
 )
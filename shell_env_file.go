@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// The env files are read by other programs than shells, so they have no
+// hook and can't unset variables. The variables removed are left out.
+
+type dockerEnv struct{}
+
+// DockerEnv outputs the env file of `docker run --env-file`
+var DockerEnv Shell = dockerEnv{}
+
+type systemd struct{}
+
+// Systemd outputs the env file of the `EnvironmentFile=` of systemd units
+var Systemd Shell = systemd{}
+
+// envFileLines returns the lines of the variables set by e, sorted by key
+func envFileLines(e ShellExport, line func(key, value string) string) (out string) {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if e[key] != nil {
+			out += line(key, *e[key])
+		}
+	}
+	return
+}
+
+func (sh dockerEnv) Hook() (string, error) {
+	return "", errors.New("this feature is not supported. Use `direnv export docker-env` to write an env file instead")
+}
+
+// Export writes KEY=VALUE lines. Docker takes the values as they are, up to
+// the end of the line, so they can't be quoted.
+func (sh dockerEnv) Export(e ShellExport) string {
+	return envFileLines(e, func(key, value string) string {
+		return key + "=" + value + "\n"
+	})
+}
+
+func (sh dockerEnv) Dump(env Env) string {
+	e := make(ShellExport, len(env))
+	for key, value := range env {
+		e.Add(key, value)
+	}
+	return sh.Export(e)
+}
+
+func (sh dockerEnv) checkKey(key string) error {
+	switch {
+	case strings.ContainsAny(key, " \t\r\n") || strings.HasPrefix(key, "#"):
+		return errors.New("docker env files only support names without spaces, not starting with '#'")
+	case !utf8.ValidString(key):
+		return errors.New("docker env files only support UTF-8")
+	}
+	return nil
+}
+
+func (sh dockerEnv) check(key, value string) error {
+	switch {
+	case strings.ContainsAny(value, "\n\r\x00"):
+		return errors.New("docker env files don't support values with newlines")
+	case !utf8.ValidString(value):
+		return errors.New("docker env files only support UTF-8")
+	}
+	return nil
+}
+
+func (sh systemd) Hook() (string, error) {
+	return "", errors.New("this feature is not supported. Use `direnv export systemd` to write an env file instead")
+}
+
+// Export writes KEY="VALUE" lines. In double quotes, systemd unescapes the
+// same characters as sh, and keeps the newlines.
+func (sh systemd) Export(e ShellExport) string {
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", `$`, `\$`)
+	return envFileLines(e, func(key, value string) string {
+		return key + `="` + escape.Replace(value) + "\"\n"
+	})
+}
+
+func (sh systemd) Dump(env Env) string {
+	e := make(ShellExport, len(env))
+	for key, value := range env {
+		e.Add(key, value)
+	}
+	return sh.Export(e)
+}
+
+// systemdHasControl returns true if str has control characters besides the
+// allowed ones
+func systemdHasControl(str, allowed string) bool {
+	for _, r := range str {
+		if (r < ' ' || r == 0x7f) && !strings.ContainsRune(allowed, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkKey follows the rules of systemd for the names of the variables
+func (sh systemd) checkKey(key string) error {
+	switch {
+	case strings.HasPrefix(key, "#") || strings.HasPrefix(key, ";") ||
+		strings.TrimSpace(key) != key || systemdHasControl(key, ""):
+		return errors.New("systemd env files only support names without control characters or surrounding spaces, not starting with '#' or ';'")
+	case !utf8.ValidString(key):
+		return errors.New("systemd env files only support UTF-8")
+	}
+	return nil
+}
+
+// check follows the rules of systemd for the values. The control characters
+// are rejected, except for tabs and newlines.
+func (sh systemd) check(key, value string) error {
+	switch {
+	case systemdHasControl(value, "\t\n"):
+		return errors.New("systemd env files don't support values with control characters")
+	case !utf8.ValidString(value):
+		return errors.New("systemd env files only support UTF-8")
+	}
+	return nil
+}
+
+var (
+	_ Shell        = (*dockerEnv)(nil)
+	_ checkedShell = (*dockerEnv)(nil)
+	_ Shell        = (*systemd)(nil)
+	_ checkedShell = (*systemd)(nil)
+)
@@ -5,7 +5,9 @@ import (
 	"strings"
 )
 
-type fish struct{}
+type fish struct {
+	pathLists *pathListPolicy
+}
 
 // Fish adds support for the fish shell as a host
 var Fish Shell = fish{}
@@ -40,6 +42,10 @@ func (sh fish) Hook() (string, error) {
 	return fishHook, nil
 }
 
+func (sh fish) withContext(ctx shellContext) Shell {
+	return fish{ctx.pathLists}
+}
+
 func (sh fish) Export(e ShellExport) (out string) {
 	for key, value := range e {
 		if value == nil {
@@ -58,15 +64,24 @@ func (sh fish) Dump(env Env) (out string) {
 	return out
 }
 
+// export sets the lists of paths as fish path variables, which fish exports
+// joined with colons. fish already splits the variables whose name ends in
+// PATH. The others need --path, which fish 3.2 introduced, so older versions
+// fall back to a plain string.
 func (sh fish) export(key, value string) string {
-	if key == "PATH" {
-		command := "set -x -g PATH"
-		for _, path := range strings.Split(value, ":") {
-			command += " " + sh.escape(path)
-		}
-		return command + ";"
+	plain := "set -x -g " + sh.escape(key) + " " + sh.escape(value) + ";"
+	if !sh.pathLists.IsPathList(key) || strings.HasSuffix(key, "PATH") {
+		return plain
+	}
+	command := "set -x -g --path " + sh.escape(key)
+	for _, path := range splitPathList(value) {
+		command += " " + sh.escape(path)
 	}
-	return "set -x -g " + sh.escape(key) + " " + sh.escape(value) + ";"
+	return command + " 2>/dev/null; or " + plain
+}
+
+func (sh fish) checkKey(key string) error {
+	return checkIdentifier(key)
 }
 
 func (sh fish) unset(key string) string {
@@ -124,3 +139,8 @@ func (sh fish) escape(str string) string {
 
 	return out
 }
+
+var (
+	_ Shell        = (*fish)(nil)
+	_ contextShell = (*fish)(nil)
+)
@@ -0,0 +1,35 @@
+//go:build go1.18
+// +build go1.18
+
+package main
+
+import (
+	"testing"
+)
+
+// FuzzShellExport checks that every target either exports the variable,
+// leaves it out, or rejects its value, without panicking.
+func FuzzShellExport(f *testing.F) {
+	for _, seed := range shellSeeds {
+		f.Add(seed[0], seed[1])
+	}
+
+	f.Fuzz(func(t *testing.T, key, value string) {
+		withLogOutput(t, Env{})
+		e := ShellExport{}
+		e.Add(key, value)
+
+		for _, target := range shellTargets {
+			shell := DetectShell(target)
+			out, err := (&EnvDiff{Prev: map[string]string{}, Next: map[string]string{key: value}}).ToShell(shell)
+			switch {
+			case checkKey(shell, key) != nil:
+				if err != nil || out != shell.Export(ShellExport{}) {
+					t.Errorf("%s: expected %q to be left out, got %q, %v", target, key, out, err)
+				}
+			case err != nil && checkExport(shell, e) == nil:
+				t.Errorf("%s: %q=%q: %v", target, key, value, err)
+			}
+		}
+	})
+}
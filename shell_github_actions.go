@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// githubActions outputs a bash script that passes the env on to the next
+// steps of a GitHub Actions job, through the files named by $GITHUB_ENV and
+// $GITHUB_PATH. The values of the secrets are masked in the logs.
+type githubActions struct {
+	ctx shellContext
+	// delimiter is the random part of the delimiters of the records
+	delimiter string
+}
+
+// GitHubActions adds support for GitHub Actions. Run
+// `eval "$(direnv export github-actions)"` in a step.
+var GitHubActions Shell = githubActions{}
+
+func (sh githubActions) Hook() (string, error) {
+	return "", errors.New("this feature is not supported. Run `eval \"$(direnv export github-actions)\"` in a step instead")
+}
+
+func (sh githubActions) withContext(ctx shellContext) Shell {
+	return githubActions{ctx, sh.delimiter}
+}
+
+// prepare picks the random delimiter, so that a failure to read random data
+// is reported before anything is written.
+func (sh githubActions) prepare() (Shell, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("can't generate the delimiter: %w", err)
+	}
+	sh.delimiter = hex.EncodeToString(buf)
+	return sh, nil
+}
+
+// Export writes the variables to $GITHUB_ENV, except for PATH whose new
+// entries go to $GITHUB_PATH. The variables and the PATH entries can't be
+// removed from the next steps, so the variables are set to an empty value
+// instead and the PATH entries are left.
+func (sh githubActions) Export(e ShellExport) string {
+	secrets := sh.ctx.secrets
+	if secrets == nil {
+		secrets = newSecretPolicy(defaultSecretPatterns, sh.ctx.env)
+	}
+
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := `: "${GITHUB_ENV:?direnv: not running in GitHub Actions}";` + "\n"
+	for _, key := range keys {
+		value := ""
+		if e[key] != nil {
+			value = *e[key]
+		}
+
+		if key == "PATH" {
+			out += sh.addPath(sh.ctx.env["PATH"], value)
+			continue
+		}
+
+		if secrets.IsSecret(key) {
+			out += sh.mask(value)
+		}
+		out += "printf '%s' " + BashEscape(sh.envRecord(key, value)) + ` >> "$GITHUB_ENV";` + "\n"
+	}
+	return out
+}
+
+func (sh githubActions) Dump(env Env) string {
+	e := make(ShellExport, len(env))
+	for key, value := range env {
+		e.Add(key, value)
+	}
+	return sh.Export(e)
+}
+
+// checkKey rejects the names that would break the syntax of $GITHUB_ENV. The
+// name ends at the first "<<", so it can't end with "<" either.
+func (sh githubActions) checkKey(key string) error {
+	if strings.Contains(key+"<", "<<") || strings.IndexFunc(key, unicode.IsSpace) >= 0 || strings.IndexFunc(key, unicode.IsControl) >= 0 {
+		return errors.New("GitHub Actions doesn't support names with spaces, control characters, '<<' or a trailing '<'")
+	}
+	return nil
+}
+
+// addPath appends the entries that are new in PATH to $GITHUB_PATH. The
+// runner puts the last line first, so they are written in reverse.
+func (sh githubActions) addPath(oldPath, newPath string) (out string) {
+	added, _ := pathListChanges(oldPath, newPath)
+	for i := len(added) - 1; i >= 0; i-- {
+		out += "printf '%s\\n' " + BashEscape(added[i]) + ` >> "$GITHUB_PATH";` + "\n"
+	}
+	return
+}
+
+// mask tells the runner to hide the value in the logs. Each line has to be
+// masked on its own.
+func (sh githubActions) mask(value string) (out string) {
+	escape := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSuffix(line, "\r"); line != "" {
+			out += "printf '%s\\n' " + BashEscape("::add-mask::"+escape.Replace(line)) + ";\n"
+		}
+	}
+	return
+}
+
+// envRecord returns the multiline syntax of $GITHUB_ENV, with a random
+// delimiter that is made longer if needed so that the value can't end the
+// record early.
+func (sh githubActions) envRecord(key, value string) string {
+	delimiter := "ghadelimiter_" + sh.delimiter
+	for i := 1; strings.Contains(value, delimiter); i++ {
+		delimiter = fmt.Sprintf("ghadelimiter_%s_%d", sh.delimiter, i)
+	}
+	return key + "<<" + delimiter + "\n" + value + "\n" + delimiter + "\n"
+}
+
+var (
+	_ Shell         = (*githubActions)(nil)
+	_ contextShell  = (*githubActions)(nil)
+	_ preparedShell = (*githubActions)(nil)
+)
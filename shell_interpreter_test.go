@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var shellTargets = []string{
+	"bash", "zsh", "fish", "gzenv", "vim", "tcsh", "json", "elvish", "nushell", "pwsh", "xonsh",
+	"elisp", "tmux", "tmux-session", "github-actions", "docker-env", "systemd", "make",
+}
+
+// shellSeeds are the variables that the interpreters are checked with. They
+// are also the seed corpus of FuzzShellExport.
+var shellSeeds = [][2]string{
+	{"FOO", "bar"},
+	{"FOO", ""},
+	{"a b", "x"},
+	{"x'; touch pwned; '", "v"},
+	{"$(id)", "multi\nline"},
+	{"-g", ""},
+	{"K<<EOF", "v"},
+	{"K<", "v"},
+	{"PATH", "/a::/b"},
+	{"XDG_DATA_DIRS", "/usr/share:/a b"},
+	{"\xff", "\xff"},
+	{"A=B", "c"},
+	{"QUOTES", `'"` + "`$\\ ‘’‚‛"},
+	{"MAKE", " lead # \\# $(x) trail\\"},
+	{"CONTROL", "\t\x01\x1f\x7f\r"},
+	{"UTF8", "♀♂ \U0001F600 �"},
+	{"BYTES", "a\x80\xfe\xffz"},
+	{"NUL", "a\x00b"},
+	{"SECRET_TOKEN", "%25\r\n::add-mask::x"},
+}
+
+// shellInterpreters run the output of a target with the program it targets,
+// and return the value of key that it ends up with.
+var shellInterpreters = map[string]func(t *testing.T, dir, out, key string) (string, error){
+	"bash": func(t *testing.T, dir, out, key string) (string, error) {
+		value, err := exec.Command("bash", "--norc", "--noprofile", "-c", out+` printf '%s' "$`+key+`"`).Output()
+		return string(value), err
+	},
+	"make": func(t *testing.T, dir, out, key string) (string, error) {
+		valueFile := filepath.Join(dir, "value")
+		makefile := out + "$(file >" + valueFile + ",$(" + key + "))\nall: ;\n"
+		if err := exec.Command("make", "-s", "-f", writeShellFile(t, dir, makefile)).Run(); err != nil {
+			return "", err
+		}
+		value, err := ioutil.ReadFile(valueFile)
+		return strings.TrimSuffix(string(value), "\n"), err
+	},
+	"vim": func(t *testing.T, dir, out, key string) (string, error) {
+		valueFile := filepath.Join(dir, "value")
+		err := exec.Command("vim", "-u", "NONE", "-i", "NONE", "-N", "-n", "-e", "-s", "-S", writeShellFile(t, dir, out),
+			"+call writefile(split($"+key+`, "\n", 1), "`+valueFile+`", "b")`, "+qa!").Run()
+		if err != nil {
+			return "", err
+		}
+		value, err := ioutil.ReadFile(valueFile)
+		return string(value), err
+	},
+	"tmux": func(t *testing.T, dir, out, key string) (string, error) {
+		// The server exits with the commands, as it has no session
+		value, err := exec.Command("tmux", "-S", filepath.Join(dir, "socket"), "-f", "/dev/null",
+			"start-server", ";", "source-file", writeShellFile(t, dir, out), ";", "show-environment", "-g", key).Output()
+		return strings.TrimSuffix(strings.TrimPrefix(string(value), key+"="), "\n"), err
+	},
+}
+
+func writeShellFile(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "out")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestShellInterpreters(t *testing.T) {
+	for target, run := range shellInterpreters {
+		target, run := target, run
+		t.Run(target, func(t *testing.T) {
+			if _, err := exec.LookPath(target); err != nil {
+				t.Skipf("%s is not installed", target)
+			}
+			shell := DetectShell(target)
+
+			for _, seed := range shellSeeds {
+				key, value := seed[0], seed[1]
+				// The environment can't hold NUL
+				if checkKey(shell, key) != nil || strings.Contains(value, "\x00") {
+					continue
+				}
+				diff := &EnvDiff{Prev: map[string]string{}, Next: map[string]string{key: value}}
+				out, err := diff.ToShell(shell)
+				if err != nil {
+					// The value can't be represented
+					continue
+				}
+
+				got, err := runShellInterpreter(t, run, out, key)
+				if err != nil {
+					t.Errorf("%q=%q: %v\n%s", key, value, err, out)
+				} else if got != value {
+					t.Errorf("%q: expected %q, got %q\n%s", key, value, got, out)
+				}
+			}
+		})
+	}
+}
+
+func runShellInterpreter(t *testing.T, run func(t *testing.T, dir, out, key string) (string, error), out, key string) (string, error) {
+	dir, err := ioutil.TempDir("", "direnv-interpreter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	return run(t, dir, out, key)
+}
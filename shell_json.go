@@ -25,6 +25,10 @@ func (sh jsonShell) Export(e ShellExport) string {
 	return string(out)
 }
 
+func (sh jsonShell) checkKey(key string) error {
+	return checkUTF8(key)
+}
+
 func (sh jsonShell) Dump(env Env) string {
 	out, err := json.MarshalIndent(env, "", "  ")
 	if err != nil {
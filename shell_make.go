@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+type gnuMake struct{}
+
+// Make outputs a fragment of Makefile for GNU make to include
+var Make Shell = gnuMake{}
+
+func (sh gnuMake) Hook() (string, error) {
+	return "", errors.New("this feature is not supported. Include the output of `direnv export make` in the Makefile instead")
+}
+
+func (sh gnuMake) Export(e ShellExport) (out string) {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if e[key] == nil {
+			out += "unexport " + key + "\n"
+		} else {
+			out += "export " + key + " := " + sh.escape(*e[key]) + "\n"
+		}
+	}
+	return out
+}
+
+func (sh gnuMake) Dump(env Env) string {
+	e := make(ShellExport, len(env))
+	for key, value := range env {
+		e.Add(key, value)
+	}
+	return sh.Export(e)
+}
+
+// checkKey rejects the names that make would parse as something else
+func (sh gnuMake) checkKey(key string) error {
+	if strings.ContainsAny(key, ":#=$()\\ \t\r\n") {
+		return errors.New("make only supports names without spaces or any of :#=$()\\")
+	}
+	return nil
+}
+
+// check rejects the values that can't be written on a single line
+func (sh gnuMake) check(key, value string) error {
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return errors.New("make doesn't support values with newlines")
+	}
+	return nil
+}
+
+// escape doubles the $ and escapes the #, along with the backslashes before
+// them. The empty reference $() protects the leading whitespace, which make
+// strips, and the trailing whitespace and backslash.
+func (sh gnuMake) escape(str string) string {
+	var out strings.Builder
+	if strings.HasPrefix(str, " ") || strings.HasPrefix(str, "\t") {
+		out.WriteString("$()")
+	}
+	backslashes := 0
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		switch c {
+		case '\\':
+			backslashes++
+		case '#':
+			out.WriteString(strings.Repeat(`\`, backslashes) + `\`)
+			backslashes = 0
+		case '$':
+			out.WriteByte('$')
+			backslashes = 0
+		default:
+			backslashes = 0
+		}
+		out.WriteByte(c)
+	}
+	if strings.HasSuffix(str, " ") || strings.HasSuffix(str, "\t") || strings.HasSuffix(str, `\`) {
+		out.WriteString("$()")
+	}
+	return out.String()
+}
+
+var (
+	_ Shell        = (*gnuMake)(nil)
+	_ checkedShell = (*gnuMake)(nil)
+)
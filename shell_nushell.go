@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type nushell struct {
+	pathLists *pathListPolicy
+}
+
+// Nushell adds support for the nushell shell as a host
+var Nushell Shell = nushell{}
+
+// The hook runs before each prompt and when the directory changes. The
+// export is a nuon record where null removes the variable, and the lists of
+// paths are lists. They get the same conversions as PATH, unless they
+// already have some.
+const nushellHook = `
+let direnv_hook = {||
+  let changes = (^"{{.SelfPath}}" export nushell | from nuon | default {})
+  let removed = ($changes | columns | where {|key| ($changes | get $key) == null })
+  if not ($removed | is-empty) {
+    hide-env ...$removed
+  }
+  let lists = ($changes | columns | where {|key| ($changes | get $key | describe) starts-with "list" })
+  for key in $lists {
+    if not ($key in ($env.ENV_CONVERSIONS? | default {} | columns)) {
+      $env.ENV_CONVERSIONS = ($env.ENV_CONVERSIONS? | default {} | upsert $key {
+        from_string: {|s| $s | split row (char esep) }
+        to_string: {|v| $v | str join (char esep) }
+      })
+    }
+  }
+  $changes | reject ...$removed | load-env
+}
+
+$env.config = ($env.config | upsert hooks.pre_prompt (
+  ($env.config.hooks?.pre_prompt? | default []) | append $direnv_hook
+))
+$env.config = ($env.config | upsert hooks.env_change.PWD (
+  ($env.config.hooks?.env_change?.PWD? | default []) | append {|before, after| do --env $direnv_hook }
+))
+`
+
+func (sh nushell) Hook() (string, error) {
+	return nushellHook, nil
+}
+
+func (sh nushell) withContext(ctx shellContext) Shell {
+	return nushell{ctx.pathLists}
+}
+
+func (sh nushell) Export(e ShellExport) string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := "null"
+		if e[key] != nil {
+			value = sh.value(key, *e[key])
+		}
+		fields = append(fields, sh.escape(key)+": "+value)
+	}
+	return "{" + strings.Join(fields, ", ") + "}\n"
+}
+
+func (sh nushell) checkKey(key string) error {
+	return checkUTF8(key)
+}
+
+func (sh nushell) Dump(env Env) string {
+	e := make(ShellExport, len(env))
+	for key, value := range env {
+		e.Add(key, value)
+	}
+	return sh.Export(e)
+}
+
+// value returns the lists of paths as lists
+func (sh nushell) value(key, value string) string {
+	if !sh.pathLists.IsPathList(key) {
+		return sh.escape(value)
+	}
+	entries := make([]string, 0)
+	for _, entry := range splitPathList(value) {
+		entries = append(entries, sh.escape(entry))
+	}
+	return "[" + strings.Join(entries, ", ") + "]"
+}
+
+// escape returns str as a double quoted nushell string. Nushell strings are
+// UTF-8, so the invalid bytes are replaced by U+FFFD.
+func (sh nushell) escape(str string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for i := 0; i < len(str); {
+		r, size := utf8.DecodeRuneInString(str[i:])
+		i += size
+		switch {
+		case r == '"':
+			out.WriteString(`\"`)
+		case r == '\\':
+			out.WriteString(`\\`)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r < ' ' || r == utf8.RuneError || r == 0x7f:
+			fmt.Fprintf(&out, `\u{%x}`, r)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
+var (
+	_ Shell        = (*nushell)(nil)
+	_ contextShell = (*nushell)(nil)
+)
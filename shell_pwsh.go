@@ -0,0 +1,99 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type pwsh struct{}
+
+// Pwsh adds support for PowerShell as a host
+var Pwsh Shell = pwsh{}
+
+// The hook wraps the prompt function. The original prompt is only saved once
+// so that evaluating the hook again doesn't make it call itself.
+const pwshHook = `
+if (-not (Test-Path Variable:global:__direnv_prompt)) {
+  $global:__direnv_prompt = $function:prompt
+}
+function global:prompt {
+  $previous_exit_code = $global:LASTEXITCODE
+  $exports = (& "{{.SelfPath}}" export pwsh) -join "` + "`" + `n"
+  if ($exports) {
+    Invoke-Expression $exports
+  }
+  $global:LASTEXITCODE = $previous_exit_code
+  & $global:__direnv_prompt
+}
+`
+
+func (sh pwsh) Hook() (string, error) {
+	return pwshHook, nil
+}
+
+func (sh pwsh) Export(e ShellExport) (out string) {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if e[key] == nil {
+			out += sh.unset(key)
+		} else {
+			out += sh.export(key, *e[key])
+		}
+	}
+	return out
+}
+
+func (sh pwsh) checkKey(key string) error {
+	return checkUTF8(key)
+}
+
+func (sh pwsh) Dump(env Env) (out string) {
+	e := make(ShellExport, len(env))
+	for key, value := range env {
+		e.Add(key, value)
+	}
+	return sh.Export(e)
+}
+
+var pwshVarNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (sh pwsh) export(key, value string) string {
+	if pwshVarNameRe.MatchString(key) {
+		return "$env:" + key + " = " + sh.escape(value) + "\n"
+	}
+	// Other names have to be braced, where ` escapes the braces
+	key = strings.NewReplacer("`", "``", "{", "`{", "}", "`}").Replace(key)
+	return "${env:" + key + "} = " + sh.escape(value) + "\n"
+}
+
+func (sh pwsh) unset(key string) string {
+	if pwshVarNameRe.MatchString(key) {
+		return "Remove-Item Env:" + key + " -ErrorAction SilentlyContinue\n"
+	}
+	return "Remove-Item -LiteralPath " + sh.escape("Env:"+key) + " -ErrorAction SilentlyContinue\n"
+}
+
+// pwshQuotes are the characters that PowerShell takes as single quotes
+var pwshQuotes = strings.NewReplacer(
+	"'", "''",
+	"‘", "‘‘",
+	"’", "’’",
+	"‚", "‚‚",
+	"‛", "‛‛",
+)
+
+// escape returns str as a single quoted string, where nothing is expanded
+// and the quotes are doubled.
+func (sh pwsh) escape(str string) string {
+	return "'" + pwshQuotes.Replace(str) + "'"
+}
+
+var (
+	_ Shell = (*pwsh)(nil)
+)
@@ -43,6 +43,10 @@ func (sh tcsh) export(key, value string) string {
 	return "setenv " + sh.escape(key) + " " + sh.escape(value) + " ;"
 }
 
+func (sh tcsh) checkKey(key string) error {
+	return checkIdentifier(key)
+}
+
 func (sh tcsh) unset(key string) string {
 	return "unsetenv " + sh.escape(key) + " ;"
 }
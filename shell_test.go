@@ -1,6 +1,8 @@
 package main
 
 import (
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -12,6 +14,220 @@ func TestBashEscape(t *testing.T) {
 	assertEqual(t, `$'\xc3\xa9'`, BashEscape("é"))
 }
 
+func TestNushellEscape(t *testing.T) {
+	assertEqual(t, `""`, Nushell.(nushell).escape(""))
+	assertEqual(t, `"escape\"quote"`, Nushell.(nushell).escape("escape\"quote"))
+	assertEqual(t, `"foo\r\n\tbar\\baz"`, Nushell.(nushell).escape("foo\r\n\tbar\\baz"))
+	assertEqual(t, `"é\u{1b}[0m"`, Nushell.(nushell).escape("é\x1b[0m"))
+	assertEqual(t, `"\u{fffd}"`, Nushell.(nushell).escape("\xff"))
+}
+
+func TestNushellExport(t *testing.T) {
+	e := ShellExport{}
+	e.Add("FOO", "bar")
+	e.Remove("BAZ")
+	assertEqual(t, "{\"BAZ\": null, \"FOO\": \"bar\"}\n", Nushell.Export(e))
+}
+
+func TestPwshExport(t *testing.T) {
+	e := ShellExport{}
+	e.Add("FOO", "it's a ‘quote’\n$HOME")
+	e.Add("A.B", "x")
+	e.Remove("BAZ")
+	e.Remove("ProgramFiles(x86)")
+	assertEqual(t, `${env:A.B} = 'x'
+Remove-Item Env:BAZ -ErrorAction SilentlyContinue
+$env:FOO = 'it''s a ‘‘quote’’
+$HOME'
+Remove-Item -LiteralPath 'Env:ProgramFiles(x86)' -ErrorAction SilentlyContinue
+`, Pwsh.Export(e))
+}
+
+func TestXonshEscape(t *testing.T) {
+	assertEqual(t, `''`, Xonsh.(xonsh).escape(""))
+	assertEqual(t, `'it\'s \\ \n\x1b é'`, Xonsh.(xonsh).escape("it's \\ \n\x1b é"))
+	assertEqual(t, `'\udcff'`, Xonsh.(xonsh).escape("\xff"))
+}
+
+func TestXonshExport(t *testing.T) {
+	e := ShellExport{}
+	e.Add("FOO", "bar")
+	e.Add("PATH", "/a:/b")
+	e.Add("XDG_DATA_DIRS", "")
+	e.Remove("BAZ")
+	assertEqual(t, `${...}.pop('BAZ', None)
+${...}['FOO'] = 'bar'
+${...}['PATH'] = ['/a', '/b']
+${...}['XDG_DATA_DIRS'] = []
+`, Xonsh.Export(e))
+}
+
+func TestElispExport(t *testing.T) {
+	e := ShellExport{}
+	e.Add("FOO", "say \"hi\"\\\n\xff")
+	e.Add("PATH", "/a:/b")
+	e.Remove("BAZ")
+	assertEqual(t, `(progn
+  (setenv "BAZ" nil)
+  (setenv "FOO" "say \"hi\"\\\012\377")
+  (setenv "PATH" "/a:/b")
+  (setq exec-path (list "/a" "/b" exec-directory)))
+`, Elisp.Export(e))
+}
+
+func TestTmuxExport(t *testing.T) {
+	e := ShellExport{}
+	e.Add("FOO", "it's $HOME")
+	e.Remove("BAZ")
+	assertEqual(t, `set-environment -g -u 'BAZ'
+set-environment -g 'FOO' 'it'\''s $HOME'
+`, Tmux.Export(e))
+	assertEqual(t, `set-environment -u 'BAZ'
+set-environment 'FOO' 'it'\''s $HOME'
+`, TmuxSession.Export(e))
+	assertEqual(t, `'a'"\377"'z'`, Tmux.(tmux).escape("a\xffz"))
+}
+
+func TestGitHubActionsExport(t *testing.T) {
+	e := ShellExport{}
+	e.Add("FOO", "a\nb")
+	e.Add("API_TOKEN", "s3cr%et")
+	e.Add("PATH", "/new:/usr/bin")
+	e.Remove("GONE")
+	sh := shellWithContext(GitHubActions, shellContext{env: Env{"PATH": "/usr/bin"}, secrets: newSecretPolicy(defaultSecretPatterns)})
+	out := sh.Export(e)
+
+	for _, expected := range []string{
+		"printf '%s\\n' $'::add-mask::s3cr%25et';\n",
+		"printf '%s\\n' $'/new' >> \"$GITHUB_PATH\";\n",
+		"$'FOO<<ghadelimiter_",
+		"$'GONE<<ghadelimiter_",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected %q in:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "/usr/bin") {
+		t.Errorf("expected only the new PATH entries in:\n%s", out)
+	}
+
+	// The delimiter can't be in the value
+	assertEqual(t, "FOO<<ghadelimiter_abc_2\nghadelimiter_abc\nghadelimiter_abc_1\nghadelimiter_abc_2\n",
+		githubActions{delimiter: "abc"}.envRecord("FOO", "ghadelimiter_abc\nghadelimiter_abc_1"))
+}
+
+func TestEnvFileExport(t *testing.T) {
+	e := ShellExport{}
+	e.Add("FOO", `a "b" $c`)
+	e.Remove("BAZ")
+
+	out, err := (&EnvDiff{Prev: map[string]string{"BAZ": "x"}, Next: map[string]string{"FOO": `a "b" $c`}}).ToShell(DockerEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, "FOO=a \"b\" $c\n", out)
+	assertEqual(t, "FOO=\"a \\\"b\\\" \\$c\"\n", Systemd.Export(e))
+
+	e.Add("MULTI", "a\nb")
+	if err = checkExport(DockerEnv, e); err == nil {
+		t.Error("expected docker-env to reject newlines")
+	}
+	if err = checkExport(Systemd, e); err != nil {
+		t.Errorf("expected systemd to accept newlines: %v", err)
+	}
+	e.Add("ESC", "\x1b")
+	if err = checkExport(Systemd, e); err == nil {
+		t.Error("expected systemd to reject control characters")
+	}
+}
+
+func TestMakeExport(t *testing.T) {
+	e := ShellExport{}
+	e.Add("FOO", `a$b #c d\#e f\`)
+	e.Add("LEAD", " x ")
+	e.Remove("BAZ")
+	assertEqual(t, `unexport BAZ
+export FOO := a$$b \#c d\\\#e f\$()
+export LEAD := $() x $()
+`, Make.Export(e))
+}
+
+func TestPathListExport(t *testing.T) {
+	e := ShellExport{}
+	e.Add("PATH", "/a::/b")
+	e.Add("MY_LIST", "x:y")
+	ctx := shellContext{pathLists: newPathListPolicy([]string{"PATH", "MY_LIST"})}
+
+	assertEqual(t, "set -x -g --path 'MY_LIST' 'x' 'y' 2>/dev/null; or set -x -g 'MY_LIST' 'x:y';",
+		shellWithContext(Fish, ctx).(fish).export("MY_LIST", "x:y"))
+	assertEqual(t, "set -x -g 'PATH' '/a::/b';", shellWithContext(Fish, ctx).(fish).export("PATH", "/a::/b"))
+	assertEqual(t, `{"MY_LIST": ["x", "y"], "PATH": ["/a", "", "/b"]}`+"\n", shellWithContext(Nushell, ctx).Export(e))
+	assertEqual(t, `{"MY_LIST":["x","y"],"PATH":["/a","","/b"]}`+"\n", shellWithContext(Elvish, ctx).Export(e))
+
+	// Without a context, the default patterns apply
+	assertEqual(t, `{"MY_LIST":"x:y","PATH":["/a","","/b"]}`+"\n", Elvish.Export(e))
+	assertEqual(t, `{"MY_LIST": "x:y", "PATH": ["/a", "", "/b"]}`+"\n", Nushell.Export(e))
+	e.Add("PATH", "")
+	assertEqual(t, `{"MY_LIST":"x:y","PATH":[]}`+"\n", Elvish.Export(e))
+	assertEqual(t, `{"MY_LIST": "x:y", "PATH": []}`+"\n", Nushell.Export(e))
+}
+
+// TestShellExportOutput pins the output of every target for a value with
+// quotes, a $ and a trailing backslash, and for a value with a newline. An
+// empty output means that the value is rejected.
+func TestShellExportOutput(t *testing.T) {
+	quotes, newline := `it's "$x" \`, "a\nb"
+	cases := []struct {
+		target, quotes, newline string
+	}{
+		{"bash", `export FOO=$'it\'s "$x" \\';`, `export FOO=$'a\nb';`},
+		{"zsh", `export FOO=$'it\'s "$x" \\';`, `export FOO=$'a\nb';`},
+		{"fish", `set -x -g 'FOO' 'it\'s "$x" \\';`, `set -x -g 'FOO' 'a'\n'b';`},
+		{"gzenv", "eJwAGADn_3siRk9PIjoiaXQncyBcIiR4XCIgXFwifQMAUosGpg==", "eJwADgDx_3siRk9PIjoiYVxuYiJ9AwAd5gQs"},
+		{"vim", "let $FOO = 'it''s \"$x\" \\'\n", "let $FOO = \"a\\x0ab\"\n"},
+		{"tcsh", `setenv FOO it\'s\ """"$"x"""\ \\ ;`, `setenv FOO a\nb ;`},
+		{"json", "{\n  \"FOO\": \"it's \\\"$x\\\" \\\\\"\n}", "{\n  \"FOO\": \"a\\nb\"\n}"},
+		{"elvish", `{"FOO":"it's \"$x\" \\"}` + "\n", `{"FOO":"a\nb"}` + "\n"},
+		{"nushell", `{"FOO": "it's \"$x\" \\"}` + "\n", `{"FOO": "a\nb"}` + "\n"},
+		{"pwsh", "$env:FOO = 'it''s \"$x\" \\'\n", "$env:FOO = 'a\nb'\n"},
+		{"xonsh", `${...}['FOO'] = 'it\'s "$x" \\'` + "\n", `${...}['FOO'] = 'a\nb'` + "\n"},
+		{"elisp", "(progn\n  (setenv \"FOO\" \"it's \\\"$x\\\" \\\\\"))\n", "(progn\n  (setenv \"FOO\" \"a\\012b\"))\n"},
+		{"tmux", `set-environment -g 'FOO' 'it'\''s "$x" \'` + "\n", "set-environment -g 'FOO' 'a\nb'\n"},
+		{"tmux-session", `set-environment 'FOO' 'it'\''s "$x" \'` + "\n", "set-environment 'FOO' 'a\nb'\n"},
+		{"github-actions",
+			": \"${GITHUB_ENV:?direnv: not running in GitHub Actions}\";\n" +
+				`printf '%s' $'FOO<<ghadelimiter_X\nit\'s "$x" \\\nghadelimiter_X\n' >> "$GITHUB_ENV";` + "\n",
+			": \"${GITHUB_ENV:?direnv: not running in GitHub Actions}\";\n" +
+				`printf '%s' $'FOO<<ghadelimiter_X\na\nb\nghadelimiter_X\n' >> "$GITHUB_ENV";` + "\n"},
+		{"docker-env", "FOO=it's \"$x\" \\\n", ""},
+		{"systemd", `FOO="it's \"\$x\" \\"` + "\n", "FOO=\"a\nb\"\n"},
+		{"make", `export FOO := it's "$$x" \$()` + "\n", ""},
+	}
+
+	// The delimiters of GitHub Actions are random
+	delimiterRe := regexp.MustCompile(`ghadelimiter_[0-9a-f]+`)
+
+	for _, c := range cases {
+		for value, expected := range map[string]string{quotes: c.quotes, newline: c.newline} {
+			diff := &EnvDiff{Prev: map[string]string{}, Next: map[string]string{"FOO": value}}
+			out, err := diff.ToShell(DetectShell(c.target))
+			if expected == "" {
+				if err == nil {
+					t.Errorf("%s: expected %q to be rejected, got %q", c.target, value, out)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %v", c.target, err)
+				continue
+			}
+			if out = delimiterRe.ReplaceAllString(out, "ghadelimiter_X"); out != expected {
+				t.Errorf("%s: expected %q, got %q", c.target, expected, out)
+			}
+		}
+	}
+}
+
 func TestShellDetection(t *testing.T) {
 	assertNotNil(t, DetectShell("-bash"))
 	assertNotNil(t, DetectShell("-/bin/bash"))
@@ -19,6 +235,15 @@ func TestShellDetection(t *testing.T) {
 	assertNotNil(t, DetectShell("-zsh"))
 	assertNotNil(t, DetectShell("-/bin/zsh"))
 	assertNotNil(t, DetectShell("-/usr/local/bin/zsh"))
+	assertNotNil(t, DetectShell("/usr/bin/nu"))
+	assertNotNil(t, DetectShell("pwsh"))
+	assertNotNil(t, DetectShell("xonsh"))
+	assertNotNil(t, DetectShell("elisp"))
+	assertNotNil(t, DetectShell("tmux"))
+	assertNotNil(t, DetectShell("github-actions"))
+	assertNotNil(t, DetectShell("docker-env"))
+	assertNotNil(t, DetectShell("systemd"))
+	assertNotNil(t, DetectShell("make"))
 }
 
 func assertNotNil(t *testing.T, a Shell) {
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// tmux outputs tmux commands, to be given to `tmux source-file -`
+type tmux struct {
+	// session scopes the variables to the current session instead of the
+	// global environment
+	session bool
+}
+
+// Tmux mirrors the env into the global environment of tmux
+var Tmux Shell = tmux{}
+
+// TmuxSession mirrors the env into the environment of the current tmux session
+var TmuxSession Shell = tmux{session: true}
+
+func (sh tmux) Hook() (string, error) {
+	return "", errors.New("this feature is not supported. Pipe `direnv export tmux` into `tmux source-file -` instead")
+}
+
+func (sh tmux) Export(e ShellExport) (out string) {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if e[key] == nil {
+			out += sh.unset(key)
+		} else {
+			out += sh.export(key, *e[key])
+		}
+	}
+	return out
+}
+
+func (sh tmux) Dump(env Env) string {
+	e := make(ShellExport, len(env))
+	for key, value := range env {
+		e.Add(key, value)
+	}
+	return sh.Export(e)
+}
+
+// checkKey rejects the names that tmux would take as an option
+func (sh tmux) checkKey(key string) error {
+	if strings.HasPrefix(key, "-") {
+		return errors.New("tmux doesn't support names starting with '-'")
+	}
+	return nil
+}
+
+func (sh tmux) command() string {
+	if sh.session {
+		return "set-environment "
+	}
+	return "set-environment -g "
+}
+
+func (sh tmux) export(key, value string) string {
+	return sh.command() + sh.escape(key) + " " + sh.escape(value) + "\n"
+}
+
+func (sh tmux) unset(key string) string {
+	return sh.command() + "-u " + sh.escape(key) + "\n"
+}
+
+// escape single quotes str. Like in sh, nothing is special in single quotes
+// and a quote is written by closing the quotes and escaping it. tmux rejects
+// invalid UTF-8 though, so these bytes are written as octal escapes in double
+// quotes, which tmux joins with the quoted parts around them.
+func (sh tmux) escape(str string) string {
+	var out strings.Builder
+	out.WriteByte('\'')
+	for i := 0; i < len(str); {
+		r, size := utf8.DecodeRuneInString(str[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&out, `'"\%03o"'`, str[i])
+		case r == '\'':
+			out.WriteString(`'\''`)
+		default:
+			out.WriteString(str[i : i+size])
+		}
+		i += size
+	}
+	out.WriteByte('\'')
+	return out.String()
+}
+
+var (
+	_ Shell = (*tmux)(nil)
+)
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 )
 
@@ -40,12 +41,36 @@ func (sh vim) unset(key string) string {
 	return "let $" + sh.escapeKey(key) + " = ''\n"
 }
 
-// TODO: support keys with special chars or fail
+func (sh vim) checkKey(key string) error {
+	return checkIdentifier(key)
+}
+
+// escapeKey returns the key as is, as checkKey only lets identifiers through
 func (sh vim) escapeKey(str string) string {
 	return str
 }
 
-// TODO: Make sure this escaping is valid
+// escapeValue uses a literal string, where only the quote is doubled, unless
+// the value has control characters. A newline would end the command, so these
+// values use a double quoted string with escapes instead.
 func (sh vim) escapeValue(str string) string {
-	return "'" + strings.Replace(str, "'", "''", -1) + "'"
+	if strings.IndexFunc(str, func(r rune) bool { return r < ' ' || r == 0x7f }) < 0 {
+		return "'" + strings.Replace(str, "'", "''", -1) + "'"
+	}
+
+	var out strings.Builder
+	out.WriteByte('"')
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; {
+		case c == '"' || c == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case c < ' ' || c == 0x7f:
+			fmt.Fprintf(&out, "\\x%02x", c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
 }
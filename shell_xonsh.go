@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type xonsh struct {
+	pathLists *pathListPolicy
+}
+
+// Xonsh adds support for the xonsh shell as a host
+var Xonsh Shell = xonsh{}
+
+// direnv is given the detyped env, as xonsh doesn't keep os.environ up to
+// date.
+const xonshHook = `
+import subprocess as __direnv_subprocess
+
+@events.on_pre_prompt
+def __direnv_pre_prompt(**kwargs):
+    out = __direnv_subprocess.run(
+        [r"{{.SelfPath}}", "export", "xonsh"],
+        stdout=__direnv_subprocess.PIPE,
+        env=${...}.detype(),
+    ).stdout
+    if out:
+        execx(out.decode("utf-8", "surrogateescape"))
+`
+
+func (sh xonsh) Hook() (string, error) {
+	return xonshHook, nil
+}
+
+func (sh xonsh) withContext(ctx shellContext) Shell {
+	return xonsh{ctx.pathLists}
+}
+
+func (sh xonsh) Export(e ShellExport) (out string) {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if e[key] == nil {
+			out += sh.unset(key)
+		} else {
+			out += sh.export(key, *e[key])
+		}
+	}
+	return out
+}
+
+func (sh xonsh) Dump(env Env) string {
+	e := make(ShellExport, len(env))
+	for key, value := range env {
+		e.Add(key, value)
+	}
+	return sh.Export(e)
+}
+
+// export sets the lists of paths as lists, which xonsh keeps as such
+func (sh xonsh) export(key, value string) string {
+	if !sh.pathLists.IsPathList(key) {
+		return "${...}[" + sh.escape(key) + "] = " + sh.escape(value) + "\n"
+	}
+	var entries []string
+	for _, entry := range splitPathList(value) {
+		entries = append(entries, sh.escape(entry))
+	}
+	return "${...}[" + sh.escape(key) + "] = [" + strings.Join(entries, ", ") + "]\n"
+}
+
+func (sh xonsh) unset(key string) string {
+	return "${...}.pop(" + sh.escape(key) + ", None)\n"
+}
+
+// escape returns str as a python string literal. The invalid UTF-8 bytes are
+// written as the surrogates that python uses for them in os.environ.
+func (sh xonsh) escape(str string) string {
+	var out strings.Builder
+	out.WriteByte('\'')
+	for i := 0; i < len(str); {
+		r, size := utf8.DecodeRuneInString(str[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			fmt.Fprintf(&out, `\udc%02x`, str[i])
+		case r == '\'' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r < 0x80 && !unicode.IsPrint(r):
+			fmt.Fprintf(&out, `\x%02x`, r)
+		case !unicode.IsPrint(r):
+			fmt.Fprintf(&out, `\U%08x`, r)
+		default:
+			out.WriteRune(r)
+		}
+		i += size
+	}
+	out.WriteByte('\'')
+	return out.String()
+}
+
+var (
+	_ Shell        = (*xonsh)(nil)
+	_ contextShell = (*xonsh)(nil)
+)
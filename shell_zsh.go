@@ -48,6 +48,10 @@ func (sh zsh) export(key, value string) string {
 	return "export " + sh.escape(key) + "=" + sh.escape(value) + ";"
 }
 
+func (sh zsh) checkKey(key string) error {
+	return checkIdentifier(key)
+}
+
 func (sh zsh) unset(key string) string {
 	return "unset " + sh.escape(key) + ";"
 }
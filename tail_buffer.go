@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// tailBuffer is an io.Writer that only keeps the last lines written to it.
+// Once flushed, everything is written through to the destination instead.
+type tailBuffer struct {
+	mu      sync.Mutex
+	max     int
+	lines   [][]byte
+	partial []byte
+	dropped int
+	out     io.Writer
+}
+
+func newTailBuffer(max int) *tailBuffer {
+	return &tailBuffer{max: max}
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.out != nil {
+		return b.out.Write(p)
+	}
+
+	b.partial = append(b.partial, p...)
+	for {
+		idx := bytes.IndexByte(b.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		b.lines = append(b.lines, b.partial[:idx+1])
+		b.partial = append([]byte(nil), b.partial[idx+1:]...)
+		if len(b.lines) > b.max {
+			b.lines = b.lines[1:]
+			b.dropped++
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes the kept lines to w. Anything written afterwards goes to w
+// directly.
+func (b *tailBuffer) Flush(w io.Writer) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.out != nil {
+		return
+	}
+	b.out = w
+
+	if b.dropped > 0 {
+		if _, err = fmt.Fprintf(w, "[... %d lines omitted ...]\n", b.dropped); err != nil {
+			return
+		}
+	}
+	for _, line := range append(b.lines, b.partial) {
+		if _, err = w.Write(line); err != nil {
+			return
+		}
+	}
+	b.lines = nil
+	b.partial = nil
+
+	return
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestTailBuffer(t *testing.T) {
+	b := newTailBuffer(3)
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(b, "line %d\n", i)
+	}
+
+	var out bytes.Buffer
+	if err := b.Flush(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[... 2 lines omitted ...]\nline 3\nline 4\nline 5\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestTailBufferUnderLimit(t *testing.T) {
+	b := newTailBuffer(3)
+	fmt.Fprint(b, "line 1\nline 2\n")
+
+	var out bytes.Buffer
+	if err := b.Flush(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "line 1\nline 2\n"; out.String() != expected {
+		t.Errorf("expected %q without header, got %q", expected, out.String())
+	}
+}
+
+func TestTailBufferPartialLine(t *testing.T) {
+	b := newTailBuffer(2)
+	// Lines split across writes are only counted once complete
+	fmt.Fprint(b, "li")
+	fmt.Fprint(b, "ne 1\nline 2\nli")
+	fmt.Fprint(b, "ne 3\nno newline")
+
+	var out bytes.Buffer
+	if err := b.Flush(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "[... 1 lines omitted ...]\nline 2\nline 3\nno newline"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestTailBufferAfterFlush(t *testing.T) {
+	b := newTailBuffer(1)
+	fmt.Fprint(b, "line 1\nline 2\n")
+
+	var out bytes.Buffer
+	if err := b.Flush(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	// Later writes are not limited anymore
+	fmt.Fprint(b, "line 3\nline 4\n")
+	expected := "[... 1 lines omitted ...]\nline 2\nline 3\nline 4\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+
+	// Flushing again does nothing, even to another writer
+	var other bytes.Buffer
+	if err := b.Flush(&other); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Flush(&out); err != nil {
+		t.Fatal(err)
+	}
+	if other.Len() != 0 || out.String() != expected {
+		t.Errorf("a second flush should not write anything, got %q and %q", other.String(), out.String())
+	}
+}
@@ -197,10 +197,19 @@ test_start "failure"
   test_eq "${DIRENV_DIFF:-}" ""
   test_eq "${DIRENV_WATCHES:-}" ""
 
+  printf '[global]\nlog_file = "%s/load.log"\n' "$PWD" > "$XDG_CONFIG_HOME/direnv/direnv.toml"
   direnv_eval
+  rm "$XDG_CONFIG_HOME/direnv/direnv.toml"
 
   test_neq "${DIRENV_DIFF:-}" ""
   test_neq "${DIRENV_WATCHES:-}" ""
+
+  echo "The failure is recorded in the log_file"
+  if ! grep -q '"outcome":"error","error":"evaluation failed: exit status 5"' load.log; then
+    echo "FAILED: unexpected log_file record: $(cat load.log)"
+    exit 1
+  fi
+  rm load.log
 test_stop
 
 test_start "watch-dir"
@@ -209,13 +218,60 @@ test_start "watch-dir"
 
     direnv_eval
 
-    if ! direnv show_dump "${DIRENV_WATCHES}" | grep -q "testfile"; then
-        echo "FAILED: testfile not added to DIRENV_WATCHES"
+    if ! direnv show_dump "${DIRENV_WATCHES}" | grep -q "testdir"; then
+        echo "FAILED: testdir not added to DIRENV_WATCHES"
         exit 1
     fi
 
     echo "After eval, watches have changed"
     test_neq "${DIRENV_WATCHES}" "${WATCHES}"
+    WATCHES=$DIRENV_WATCHES
+
+    echo "Reloading (should be no-op)"
+    direnv_eval
+    test_eq "${DIRENV_WATCHES}" "${WATCHES}"
+
+    echo "Adding a file to the watched dir (should reload)"
+    touch testdir/subdir/newfile
+    direnv_eval
+    rm testdir/subdir/newfile
+    test_neq "${DIRENV_WATCHES}" "${WATCHES}"
+    unset WATCHES
+test_stop
+
+test_start "watch-file-sourced"
+    direnv_eval
+
+    echo "Relative watches are resolved from the sourced .envrc"
+    if ! direnv show_dump "${DIRENV_WATCHES}" | grep -q "watch-file-sourced/sub/inner.yml"; then
+        echo "FAILED: sub/inner.yml not added to DIRENV_WATCHES"
+        exit 1
+    fi
+    WATCHES=$DIRENV_WATCHES
+
+    echo "Creating the watched file (should reload)"
+    touch sub/inner.yml
+    direnv_eval
+    rm sub/inner.yml
+    test_neq "${DIRENV_WATCHES}" "${WATCHES}"
+    unset WATCHES
+test_stop
+
+test_start "expire-after"
+  direnv_eval
+  EXPIRING_BEFORE=$EXPIRING
+
+  echo "Reloading before the deadline (should be no-op)"
+  direnv_eval
+  test_eq "$EXPIRING" "$EXPIRING_BEFORE"
+
+  sleep 2
+
+  echo "Reloading after the deadline (should reload)"
+  direnv_eval
+  test_neq "$EXPIRING" "$EXPIRING_BEFORE"
+
+  unset EXPIRING_BEFORE
 test_stop
 
 # Context: foo/bar is a symlink to ../baz. foo/ contains and .envrc file
@@ -232,8 +232,8 @@ begin
 
     direnv_eval
 
-    if ! direnv show_dump $DIRENV_WATCHES | grep -q testfile
-        echo "FAILED: testfile not added to DIRENV_WATCHES"
+    if ! direnv show_dump $DIRENV_WATCHES | grep -q testdir
+        echo "FAILED: testdir not added to DIRENV_WATCHES"
         exit 1
     end
 
@@ -192,6 +192,16 @@ test_name source_env_if_exists
   [[ $FOO = bar ]]
 )
 
+test_name mark_secret
+(
+  load_stdlib
+
+  unset DIRENV_SECRETS
+  mark_secret FOO BAR
+  mark_secret FOO
+  assert_eq "$DIRENV_SECRETS" "FOO:BAR"
+)
+
 # test strict_env and unstrict_env
 ./strict_env_test.bash
 
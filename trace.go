@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// traceSetup returns the bash code that turns on the xtrace for the rest of
+// the load. Each traced command is written to tracePath as a line of tab
+// separated fields, the arrays being joined with spaces:
+//
+//	+[+...]EPOCHREALTIME PWD LINENO BASH_LINENO FUNCNAME BASH_SOURCE
+//	       BASH_SUBSHELL BASH_COMMAND COMMAND
+//
+// BASH_COMMAND is the simple command as written, while COMMAND is what bash
+// traces after the expansions. It can take several lines to trace a single
+// simple command, for example one per assignment.
+//
+// EPOCHREALTIME was introduced in bash 5.
+func traceSetup(tracePath string) string {
+	return fmt.Sprintf(
+		`{ [[ -n ${EPOCHREALTIME-} ]] || { echo "direnv: tracing the .envrc requires bash 5 or later" >&2; exit 1; }; }`+
+			` && exec {__direnv_trace_fd}>"%s"`+
+			` && BASH_XTRACEFD=$__direnv_trace_fd`+
+			` && PS4=$'+${EPOCHREALTIME}\t${PWD}\t${LINENO}\t${BASH_LINENO[@]-}\t${FUNCNAME[@]-}\t${BASH_SOURCE[@]-}\t${BASH_SUBSHELL}\t${BASH_COMMAND//[\t\n]/ }\t'`+
+			` && set -x`,
+		tracePath,
+	)
+}
+
+// traceLine is a command from the xtrace
+type traceLine struct {
+	time        time.Time
+	funcs       []string     // innermost first, like FUNCNAME
+	frames      []traceFrame // innermost first, frames[0] being the command itself
+	subshell    int
+	bashCommand string
+	command     string
+}
+
+// traceFrame is a location in the call stack of a traced command
+type traceFrame struct {
+	source   string
+	line     int
+	funcName string
+}
+
+var traceLineRe = regexp.MustCompile(`^\++(\d+)[.,](\d+)\t([^\t]*)\t(\d+)\t([^\t]*)\t([^\t]*)\t([^\t]*)\t(\d+)\t([^\t]*)\t(.*)$`)
+
+// source returns the file the command comes from
+func (l traceLine) source() string {
+	return l.frames[0].source
+}
+
+func parseTraceLine(line string) (l traceLine, ok bool) {
+	m := traceLineRe.FindStringSubmatch(line)
+	if m == nil {
+		return l, false
+	}
+	sec, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return l, false
+	}
+	usec, err := strconv.ParseInt((m[2] + "000000")[:6], 10, 64)
+	if err != nil {
+		return l, false
+	}
+	l.time = time.Unix(sec, usec*1000)
+	l.subshell, _ = strconv.Atoi(m[8])
+	l.bashCommand = m[9]
+	l.command = m[10]
+
+	pwd := m[3]
+	lineno, _ := strconv.Atoi(m[4])
+	callerLines := strings.Fields(m[5])
+	l.funcs = strings.Fields(m[6])
+	sources := strings.Split(m[7], " ")
+	if m[7] == "" || len(sources) != len(l.funcs) {
+		// Paths with spaces can't be told apart
+		sources = make([]string, len(l.funcs))
+	}
+
+	resolve := func(source string) string {
+		if source != "" && source != "environment" && !filepath.IsAbs(source) {
+			return filepath.Join(pwd, source)
+		}
+		return source
+	}
+
+	l.frames = []traceFrame{{line: lineno}}
+	for i, funcName := range l.funcs {
+		l.frames[i].source = resolve(sources[i])
+		l.frames[i].funcName = funcName
+		if i < len(callerLines) && i+1 < len(l.funcs) {
+			callerLine, _ := strconv.Atoi(callerLines[i])
+			l.frames = append(l.frames, traceFrame{line: callerLine})
+		}
+	}
+	return l, true
+}
+
+// readTrace parses the xtrace written by the bash code of traceSetup
+func readTrace(trace io.Reader) (lines []traceLine, err error) {
+	scanner := bufio.NewScanner(trace)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		// Lines that don't match are the continuation of a multi-line command
+		if l, ok := parseTraceLine(scanner.Text()); ok {
+			lines = append(lines, l)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// commandName returns the first word of a traced command, as quoted by
+// bash, or an empty string for assignments.
+func commandName(command string) string {
+	if strings.HasPrefix(command, "'") {
+		if end := strings.Index(command[1:], "'"); end >= 0 {
+			return command[1 : end+1]
+		}
+		return command[1:]
+	}
+	word := command
+	if i := strings.IndexAny(word, " \t"); i >= 0 {
+		word = word[:i]
+	}
+	if strings.Contains(word, "=") {
+		return ""
+	}
+	return word
+}